@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/Diverstt/Calculator_Yandex/internal/agent"
 )
@@ -13,7 +17,43 @@ func main() {
 	if err != nil || workers <= 0 {
 		workers = 2
 	}
-	log.Printf("Запуск агента с %d рабочими горутинами...", workers)
-	agent.StartWorkers(workers)
-	select {}
+	heartbeatInterval, err := time.ParseDuration(os.Getenv("AGENT_HEARTBEAT_INTERVAL"))
+	if err != nil || heartbeatInterval <= 0 {
+		heartbeatInterval = 5 * time.Second
+	}
+	shutdownTimeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Запуск агента %s с %d рабочими горутинами...", agent.ID(), workers)
+	if err := agent.Register(workers); err != nil {
+		log.Printf("Не удалось зарегистрировать агента, повторная попытка с пульсом: %v", err)
+	}
+	go agent.RunHeartbeats(ctx, workers, heartbeatInterval)
+	transport := agent.NewTransportFromEnv(workers)
+	done := agent.StartWorkers(ctx, workers, transport)
+
+	<-ctx.Done()
+	log.Printf("Получен сигнал остановки, агент завершает текущие задачи...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Printf("Рабочие не завершились за %s", shutdownTimeout)
+	}
+	if outbox, ok := transport.(*agent.Outbox); ok {
+		if err := outbox.Flush(shutdownCtx); err != nil {
+			log.Printf("Не все результаты отправлены: %v", err)
+		}
+	}
+	transport.Close()
+	if err := agent.Deregister(); err != nil {
+		log.Printf("Не удалось снять агента с учёта: %v", err)
+	}
+	log.Printf("Агент остановлен")
 }
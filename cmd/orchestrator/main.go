@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/storage"
 )
 
 func main() {
@@ -13,9 +20,112 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	shutdownTimeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	apiServer := orchestrator.NewServer()
 
-	log.Printf("Сервер запущен на порту %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, apiServer.Router))
+	// Журнал событий полнее снимка, поэтому при наличии обоих состояние
+	// восстанавливается из журнала.
+	eventLogPath := os.Getenv("EVENT_LOG_PATH")
+	if eventLogPath != "" {
+		if err := apiServer.OpenEventLog(eventLogPath); err != nil {
+			log.Fatalf("Не удалось восстановить состояние из журнала %s: %v", eventLogPath, err)
+		}
+		defer apiServer.Events.Close()
+		compactInterval, err := time.ParseDuration(os.Getenv("EVENT_LOG_COMPACT_INTERVAL"))
+		if err != nil || compactInterval <= 0 {
+			compactInterval = 10 * time.Minute
+		}
+		go apiServer.RunEventLogCompaction(ctx, compactInterval)
+	}
+	snapshotPath := os.Getenv("SNAPSHOT_PATH")
+	if snapshotPath != "" {
+		if eventLogPath == "" {
+			if err := apiServer.LoadSnapshot(snapshotPath); err != nil {
+				log.Fatalf("Не удалось восстановить состояние из %s: %v", snapshotPath, err)
+			}
+		}
+		snapshotInterval, err := time.ParseDuration(os.Getenv("SNAPSHOT_INTERVAL"))
+		if err != nil || snapshotInterval <= 0 {
+			snapshotInterval = 30 * time.Second
+		}
+		go apiServer.RunSnapshots(ctx, snapshotPath, snapshotInterval)
+	}
+
+	// Хранилище дополняет журнал и снимок выражениями, которых в них нет.
+	if err := apiServer.OpenStore(storage.ConfigFromEnv()); err != nil {
+		log.Fatalf("Не удалось открыть хранилище выражений: %v", err)
+	}
+	if apiServer.Store != nil {
+		defer apiServer.CloseStore()
+	}
+
+	watchdogInterval, err := time.ParseDuration(os.Getenv("WATCHDOG_INTERVAL"))
+	if err != nil || watchdogInterval <= 0 {
+		watchdogInterval = time.Second
+	}
+	go apiServer.RunWatchdog(ctx, watchdogInterval)
+
+	listener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("Не удалось открыть порт gRPC %s: %v", grpcPort, err)
+	}
+	grpcServer := apiServer.NewGRPCServer()
+	go func() {
+		log.Printf("gRPC-сервис задач запущен на порту %s", grpcPort)
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("Ошибка gRPC-сервера: %v", err)
+		}
+	}()
+
+	httpServer := &http.Server{Addr: ":" + port, Handler: apiServer.Router}
+	go func() {
+		log.Printf("Сервер запущен на порту %s", port)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Получен сигнал остановки, новые выражения не принимаются")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Пока сервер принимает результаты, ждём задачи, уже выданные агентам.
+	apiServer.BeginShutdown()
+	apiServer.Drain(shutdownCtx)
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Не все HTTP-запросы завершились: %v", err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
+
+	report := apiServer.Report()
+	if snapshotPath != "" {
+		if err := apiServer.SaveSnapshot(snapshotPath); err != nil {
+			log.Printf("Ошибка при сохранении снимка %s: %v", snapshotPath, err)
+		} else {
+			log.Printf("Состояние сохранено в %s", snapshotPath)
+		}
+	}
+	log.Printf("Оркестратор остановлен: невычисленных выражений %d, задач в очереди %d, задач у агентов %d",
+		report.PendingExpressions, report.QueuedTasks, report.DispatchedTasks)
 }
@@ -0,0 +1,9 @@
+package agent
+
+import "github.com/Diverstt/Calculator_Yandex/internal/retry"
+
+// NewBackoff создаёт политику повторов с параметрами из AGENT_RETRY_BASE и
+// AGENT_RETRY_MAX.
+func NewBackoff() *retry.Backoff {
+	return &retry.Backoff{Base: retryBase, Max: retryMax}
+}
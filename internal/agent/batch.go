@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// batchTransport получает задачи и отправляет результаты пакетами: отдельная
+// горутина забирает до size задач запросом /internal/task?limit=N и раздаёт
+// их рабочим, а результаты, накопленные в Outbox, уходят одним запросом на
+// /internal/task/results. Так число HTTP-запросов не растёт с числом
+// рабочих горутин.
+type batchTransport struct {
+	baseURL    string
+	agentID    string
+	operations []string
+	wait       time.Duration
+	size       int
+
+	tasks  chan *models.Task
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewBatchTransport создаёт пакетный HTTP-транспорт с размером пакета size.
+func NewBatchTransport(baseURL, agentID string, ops []string, wait time.Duration, size int) Transport {
+	if size < 1 {
+		size = 1
+	}
+	t := &batchTransport{
+		baseURL:    baseURL,
+		agentID:    agentID,
+		operations: ops,
+		wait:       wait,
+		size:       size,
+		tasks:      make(chan *models.Task, size),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	go t.fetchLoop()
+	return t
+}
+
+func (t *batchTransport) Fetch(ctx context.Context) (*models.Task, error) {
+	select {
+	case task := <-t.tasks:
+		return task, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *batchTransport) Submit(res models.Result) error {
+	return t.SubmitBatch([]models.Result{res})
+}
+
+// Close прекращает получение задач. Уже полученные, но не выполненные
+// задачи оркестратор вернёт в очередь при снятии агента с работы.
+func (t *batchTransport) Close() error {
+	t.cancel()
+	return nil
+}
+
+// fetchLoop запрашивает задачи пакетами и передаёт их рабочим.
+func (t *batchTransport) fetchLoop() {
+	backoff := NewBackoff()
+	for t.ctx.Err() == nil {
+		tasks, err := t.fetchBatch()
+		if err != nil {
+			if t.ctx.Err() != nil {
+				return
+			}
+			delay := backoff.Next()
+			log.Printf("Ошибка при получении пакета задач, повтор через %s: %v", delay, err)
+			t.sleep(delay)
+			continue
+		}
+		backoff.Reset()
+		if len(tasks) == 0 && t.wait == 0 {
+			t.sleep(2 * time.Second)
+		}
+		for _, task := range tasks {
+			select {
+			case t.tasks <- task:
+			case <-t.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// sleep ждёт d или закрытия транспорта.
+func (t *batchTransport) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-t.ctx.Done():
+	}
+}
+
+func (t *batchTransport) fetchBatch() ([]*models.Task, error) {
+	query := url.Values{"wait": {t.wait.String()}, "limit": {strconv.Itoa(t.size)}}
+	if len(t.operations) > 0 {
+		query.Set("ops", strings.Join(t.operations, ","))
+	}
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, t.baseURL+"/internal/task?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(models.AgentIDHeader, t.agentID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("оркестратор ответил %s", resp.Status)
+	}
+	var response struct {
+		Tasks []*models.Task `json:"tasks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Tasks, nil
+}
+
+// SubmitBatch отправляет результаты одним запросом.
+func (t *batchTransport) SubmitBatch(results []models.Result) error {
+	data, _ := json.Marshal(map[string]interface{}{"results": results})
+	req, err := http.NewRequest(http.MethodPost, t.baseURL+"/internal/task/results", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.AgentIDHeader, t.agentID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("оркестратор ответил %s", resp.Status)
+	}
+	return nil
+}
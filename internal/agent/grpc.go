@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/taskpb"
+)
+
+// GRPCConn — соединение агента с gRPC-сервисом задач оркестратора: поток
+// задач FetchTasks и поток результатов SubmitResults.
+type GRPCConn struct {
+	cc      *grpc.ClientConn
+	cancel  context.CancelFunc
+	tasks   taskpb.TaskService_FetchTasksClient
+	results taskpb.TaskService_SubmitResultsClient
+	mu      sync.Mutex
+}
+
+// DialGRPC подключает агента agentID к gRPC-сервису задач по адресу addr.
+// ops — выполняемые агентом операции (пустой список — все), capacity —
+// сколько задач агент готов выполнять одновременно.
+func DialGRPC(addr, agentID string, ops []string, capacity int) (*GRPCConn, error) {
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.AppendToOutgoingContext(ctx, models.AgentIDHeader, agentID)
+	client := taskpb.NewTaskServiceClient(cc)
+	tasks, err := client.FetchTasks(ctx, &taskpb.FetchTasksRequest{Capacity: int32(capacity), AgentId: agentID, Operations: ops})
+	if err != nil {
+		cancel()
+		cc.Close()
+		return nil, err
+	}
+	results, err := client.SubmitResults(ctx)
+	if err != nil {
+		cancel()
+		cc.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			ack, err := results.Recv()
+			if err != nil {
+				return
+			}
+			if ack.GetStatus() != http.StatusOK {
+				log.Printf("Оркестратор не принял результат задачи %s: %s", ack.GetId(), ack.GetMessage())
+			}
+		}
+	}()
+	return &GRPCConn{cc: cc, cancel: cancel, tasks: tasks, results: results}, nil
+}
+
+// Recv ожидает следующую задачу от оркестратора.
+func (c *GRPCConn) Recv() (*models.Task, error) {
+	msg, err := c.tasks.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return msg.ToModel(), nil
+}
+
+// Send отправляет оркестратору результат задачи.
+func (c *GRPCConn) Send(res models.Result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results.Send(taskpb.FromResult(res))
+}
+
+// Close закрывает потоки и соединение.
+func (c *GRPCConn) Close() error {
+	c.cancel()
+	return c.cc.Close()
+}
+
+// NewGRPCTransport создаёт транспорт поверх gRPC-сервиса задач.
+func NewGRPCTransport(addr, agentID string, ops []string, capacity int) Transport {
+	return newPushTransport(capacity, func() (pushConn, error) {
+		return DialGRPC(addr, agentID, ops, capacity)
+	})
+}
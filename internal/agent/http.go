@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// httpTransport получает задачи опросом /internal/task и отправляет
+// результаты на /internal/task/result.
+type httpTransport struct {
+	baseURL    string
+	agentID    string
+	operations []string
+	wait       time.Duration
+}
+
+// NewHTTPTransport создаёт транспорт, опрашивающий оркестратор по HTTP от
+// имени агента agentID, выполняющего операции ops (пустой список — все).
+// wait — время ожидания задачи на стороне оркестратора (long polling).
+func NewHTTPTransport(baseURL, agentID string, ops []string, wait time.Duration) Transport {
+	return &httpTransport{baseURL: baseURL, agentID: agentID, operations: ops, wait: wait}
+}
+
+func (t *httpTransport) Fetch(ctx context.Context) (*models.Task, error) {
+	query := url.Values{"wait": {t.wait.String()}}
+	if len(t.operations) > 0 {
+		query.Set("ops", strings.Join(t.operations, ","))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/internal/task?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(models.AgentIDHeader, t.agentID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		if t.wait == 0 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-ctx.Done():
+			}
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("оркестратор ответил %s", resp.Status)
+	}
+
+	var response struct {
+		Task models.Task `json:"task"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response.Task, nil
+}
+
+func (t *httpTransport) Submit(res models.Result) error {
+	data, _ := json.Marshal(res)
+	req, err := http.NewRequest(http.MethodPost, t.baseURL+"/internal/task/result", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.AgentIDHeader, t.agentID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Ответы 4xx окончательны (задача неизвестна или выражение уже не
+	// вычисляется), повторять стоит только при ошибке самого оркестратора.
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("оркестратор ответил %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() error {
+	return nil
+}
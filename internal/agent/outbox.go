@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/fsutil"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// outboxBatch — сколько результатов отправляется одной попыткой, если
+// транспорт поддерживает пакетную отправку.
+const outboxBatch = 100
+
+// flushPollInterval — как часто Flush проверяет, опустела ли очередь.
+const flushPollInterval = 20 * time.Millisecond
+
+// batchSubmitter — транспорт, умеющий отправлять несколько результатов одним запросом.
+type batchSubmitter interface {
+	SubmitBatch(results []models.Result) error
+}
+
+// Outbox — транспорт-обёртка, которая не теряет вычисленные результаты:
+// Submit кладёт результат в очередь на отправку (при заданном пути — ещё и
+// в файл), а отдельная горутина доставляет его оркестратору, повторяя
+// попытки с экспоненциальной задержкой. Оркестратор игнорирует повторно
+// доставленные результаты, поэтому повторная отправка безопасна.
+type Outbox struct {
+	Transport
+
+	path    string
+	mu      sync.Mutex
+	pending []models.Result
+	wake    chan struct{}
+}
+
+// NewOutbox оборачивает transport очередью отправки. Если path не пуст,
+// очередь сохраняется в этот файл, а результаты, не отправленные до
+// перезапуска агента, загружаются из него и отправляются заново.
+func NewOutbox(transport Transport, path string) (*Outbox, error) {
+	o := &Outbox{Transport: transport, path: path, wake: make(chan struct{}, 1)}
+	var err error
+	if path != "" {
+		err = o.load()
+		if len(o.pending) > 0 {
+			log.Printf("Загружено %d неотправленных результатов из %s", len(o.pending), path)
+			o.signal()
+		}
+	}
+	go o.run()
+	return o, err
+}
+
+// Submit ставит результат в очередь на отправку.
+func (o *Outbox) Submit(res models.Result) error {
+	o.mu.Lock()
+	o.pending = append(o.pending, res)
+	err := o.persist()
+	o.mu.Unlock()
+	o.signal()
+	return err
+}
+
+// Pending возвращает число ещё не доставленных результатов.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Flush ждёт доставки всех результатов из очереди или отмены ctx. При
+// отмене недоставленные результаты остаются в файле очереди, если он задан.
+func (o *Outbox) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for o.Pending() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("не доставлено результатов: %d", o.Pending())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run доставляет результаты по порядку, пока очередь не опустеет.
+func (o *Outbox) run() {
+	backoff := NewBackoff()
+	for range o.wake {
+		for {
+			o.mu.Lock()
+			batch := o.pending
+			if len(batch) > outboxBatch {
+				batch = batch[:outboxBatch]
+			}
+			batch = append([]models.Result(nil), batch...)
+			o.mu.Unlock()
+			if len(batch) == 0 {
+				break
+			}
+
+			sent, err := o.send(batch)
+			if sent > 0 {
+				o.mu.Lock()
+				o.pending = o.pending[sent:]
+				if err := o.persist(); err != nil {
+					log.Printf("Ошибка при сохранении очереди результатов: %v", err)
+				}
+				o.mu.Unlock()
+			}
+			if err != nil {
+				delay := backoff.Next()
+				log.Printf("Ошибка при отправке результатов, повтор через %s: %v", delay, err)
+				time.Sleep(delay)
+				continue
+			}
+			backoff.Reset()
+		}
+	}
+}
+
+// send отправляет пакет и возвращает число доставленных результатов.
+func (o *Outbox) send(batch []models.Result) (int, error) {
+	if bs, ok := o.Transport.(batchSubmitter); ok {
+		if err := bs.SubmitBatch(batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+	for i, res := range batch {
+		if err := o.Transport.Submit(res); err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
+
+func (o *Outbox) load() error {
+	data, err := os.ReadFile(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &o.pending)
+}
+
+// persist атомарно перезаписывает файл очереди. Вызывается под o.mu.
+func (o *Outbox) persist() error {
+	if o.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(o.pending)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(o.path, data)
+}
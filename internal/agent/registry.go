@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// Version — версия агента, сообщаемая оркестратору при регистрации.
+// Может быть переопределена при сборке: -ldflags "-X .../internal/agent.Version=1.2.3".
+var Version = "dev"
+
+// ID возвращает идентификатор агента.
+func ID() string {
+	return agentID
+}
+
+// Register регистрирует агента в оркестраторе.
+func Register(computingPower int) error {
+	hostname, _ := os.Hostname()
+	info := models.AgentInfo{
+		ID:             agentID,
+		Hostname:       hostname,
+		ComputingPower: computingPower,
+		Version:        Version,
+		Operations:     agentOperations,
+	}
+	resp, err := postJSON("/internal/agents/register", info)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("оркестратор отклонил регистрацию: %s", resp.Status)
+	}
+	return nil
+}
+
+// RunHeartbeats раз в interval сообщает оркестратору, что агент жив. Если
+// оркестратор не знает агента (например, после перезапуска), агент
+// регистрируется заново.
+// Блокируется до отмены ctx.
+func RunHeartbeats(ctx context.Context, computingPower int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		resp, err := postJSON("/internal/agents/heartbeat", map[string]string{"id": agentID})
+		if err != nil {
+			log.Printf("Ошибка при отправке пульса: %v", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			if err := Register(computingPower); err != nil {
+				log.Printf("Ошибка повторной регистрации агента: %v", err)
+			}
+		}
+	}
+}
+
+// Deregister сообщает оркестратору, что агент завершает работу: выданные
+// агенту задачи без результата сразу возвращаются в очередь.
+func Deregister() error {
+	resp, err := postJSON("/internal/agents/deregister", map[string]string{"id": agentID})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("оркестратор отклонил снятие агента: %s", resp.Status)
+	}
+	return nil
+}
+
+func postJSON(path string, body interface{}) (*http.Response, error) {
+	data, _ := json.Marshal(body)
+	return http.Post(orchestratorURL+path, "application/json", bytes.NewBuffer(data))
+}
@@ -0,0 +1,306 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// StreamConn — постоянное WebSocket-соединение агента с оркестратором, по
+// которому оркестратор присылает задачи, а агент отправляет результаты.
+type StreamConn struct {
+	ws *websocket.Conn
+}
+
+// DialStream открывает потоковое соединение агента agentID с оркестратором
+// по адресу baseURL (http или https, возможно с префиксом пути). ops —
+// выполняемые агентом операции (пустой список — все), capacity — сколько
+// задач агент готов выполнять одновременно. Прокси берётся из переменных
+// окружения HTTP_PROXY, HTTPS_PROXY и NO_PROXY, как у HTTP-транспорта.
+func DialStream(baseURL, agentID string, ops []string, capacity int) (*StreamConn, error) {
+	origin, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	location := *origin
+	switch origin.Scheme {
+	case "http":
+		location.Scheme = "ws"
+	case "https":
+		location.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("неподдерживаемая схема адреса оркестратора: %q", origin.Scheme)
+	}
+	location.Path = strings.TrimSuffix(origin.Path, "/") + "/internal/task/stream"
+	query := url.Values{"capacity": {strconv.Itoa(capacity)}, "agent_id": {agentID}}
+	if len(ops) > 0 {
+		query.Set("ops", strings.Join(ops, ","))
+	}
+	location.RawQuery = query.Encode()
+
+	config, err := websocket.NewConfig(location.String(), origin.Scheme+"://"+origin.Host)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{models.StreamProtocol}
+	conn, err := dialOrchestrator(origin)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("оркестратор отклонил потоковое соединение: %w", err)
+	}
+	return &StreamConn{ws: ws}, nil
+}
+
+// dialOrchestrator открывает соединение с хостом оркестратора: напрямую или
+// туннелем через HTTP-прокси, а для https — с TLS поверх него.
+func dialOrchestrator(u *url.URL) (net.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if proxy == nil {
+		conn, err = net.Dial("tcp", addr)
+	} else {
+		conn, err = dialProxyTunnel(proxy, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialProxyTunnel открывает через HTTP-прокси туннель (метод CONNECT) к addr.
+func dialProxyTunnel(proxy *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// До ответа прокси сервер ничего не отправляет, поэтому буфер чтения
+	// после ответа пуст.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("прокси отклонил соединение с %s: %s", addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// Recv ожидает следующую задачу от оркестратора.
+func (c *StreamConn) Recv() (*models.Task, error) {
+	for {
+		var msg models.StreamMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			return nil, err
+		}
+		if msg.Type == models.StreamTask && msg.Task != nil {
+			return msg.Task, nil
+		}
+	}
+}
+
+// Send отправляет оркестратору результат задачи.
+func (c *StreamConn) Send(res models.Result) error {
+	return websocket.JSON.Send(c.ws, models.StreamMessage{Type: models.StreamResult, Result: &res})
+}
+
+// Close закрывает соединение.
+func (c *StreamConn) Close() error {
+	return c.ws.Close()
+}
+
+// pushConn — соединение, по которому оркестратор сам присылает задачи.
+type pushConn interface {
+	Recv() (*models.Task, error)
+	Send(res models.Result) error
+	Close() error
+}
+
+// pushTransport поддерживает соединение с оркестратором, передавая
+// полученные задачи рабочим горутинам, а их результаты — оркестратору.
+// При разрыве соединение восстанавливается, а ещё не отправленные
+// результаты передаются по новому.
+type pushTransport struct {
+	tasks   chan *models.Task
+	results chan models.Result
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewStreamTransport создаёт транспорт поверх WebSocket-соединения.
+func NewStreamTransport(baseURL, agentID string, ops []string, capacity int) Transport {
+	return newPushTransport(capacity, func() (pushConn, error) {
+		return DialStream(baseURL, agentID, ops, capacity)
+	})
+}
+
+func newPushTransport(capacity int, dial func() (pushConn, error)) *pushTransport {
+	t := &pushTransport{
+		tasks:   make(chan *models.Task),
+		results: make(chan models.Result, capacity),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go t.supervise(dial)
+	return t
+}
+
+func (t *pushTransport) Fetch(ctx context.Context) (*models.Task, error) {
+	select {
+	case task := <-t.tasks:
+		return task, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *pushTransport) Submit(res models.Result) error {
+	t.results <- res
+	return nil
+}
+
+// Close отправляет накопленные результаты и закрывает соединение; задачи,
+// полученные, но не выполненные, оркестратор вернёт в очередь.
+func (t *pushTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	<-t.stopped
+	return nil
+}
+
+func (t *pushTransport) supervise(dial func() (pushConn, error)) {
+	defer close(t.stopped)
+	var pending *models.Result
+	backoff := NewBackoff()
+	for {
+		conn, err := dial()
+		if err != nil {
+			delay := backoff.Next()
+			log.Printf("Ошибка подключения к оркестратору, повтор через %s: %v", delay, err)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-t.done:
+				return
+			}
+		}
+		backoff.Reset()
+		log.Printf("Установлено потоковое соединение с оркестратором")
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				task, err := conn.Recv()
+				if err != nil {
+					log.Printf("Потоковое соединение разорвано: %v", err)
+					return
+				}
+				select {
+				case t.tasks <- task:
+				case <-t.done:
+					return
+				}
+			}
+		}()
+
+		var stopping bool
+		pending, stopping = t.forward(conn, closed, pending)
+		conn.Close()
+		<-closed
+		if stopping {
+			return
+		}
+	}
+}
+
+// forward отправляет результаты по соединению до его разрыва или закрытия
+// транспорта и возвращает результат, который не удалось отправить.
+func (t *pushTransport) forward(conn pushConn, closed <-chan struct{}, pending *models.Result) (*models.Result, bool) {
+	if pending != nil {
+		if err := conn.Send(*pending); err != nil {
+			return pending, false
+		}
+	}
+	for {
+		select {
+		case res := <-t.results:
+			if err := conn.Send(res); err != nil {
+				return &res, false
+			}
+		case <-closed:
+			return nil, false
+		case <-t.done:
+			for {
+				select {
+				case res := <-t.results:
+					if err := conn.Send(res); err != nil {
+						log.Printf("Не удалось отправить результат задачи %s при остановке: %v", res.ID, err)
+						return nil, true
+					}
+				default:
+					return nil, true
+				}
+			}
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package agent
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Diverstt/Calculator_Yandex/internal/models"
@@ -14,66 +15,238 @@ import (
 
 var orchestratorURL string
 
+// orchestratorGRPCAddr — адрес gRPC-сервиса задач оркестратора.
+var orchestratorGRPCAddr string
+
+// agentID — идентификатор агента, под которым он регистрируется в оркестраторе.
+var agentID string
+
+// agentOperations — операции, которые выполняет агент (AGENT_OPERATIONS,
+// например "+,-"); пустой список — все поддерживаемые.
+var agentOperations []string
+
+// taskWait — время, на которое агент удерживает запрос задачи в ожидании её
+// появления (long polling). При нулевом значении агент опрашивает
+// оркестратор с паузой между запросами.
+var taskWait = 30 * time.Second
+
+// batchSize — сколько задач и результатов HTTP-транспорт передаёт одним
+// запросом (AGENT_BATCH_SIZE). При значении 1 пакетный режим выключен.
+var batchSize = 1
+
+// retryBase и retryMax — начальная и наибольшая пауза между повторными
+// попытками связаться с оркестратором (AGENT_RETRY_BASE, AGENT_RETRY_MAX).
+var (
+	retryBase = 500 * time.Millisecond
+	retryMax  = 30 * time.Second
+)
+
+// outboxPath — файл, в котором сохраняются неотправленные результаты
+// (AGENT_OUTBOX_PATH); пустое значение — хранить только в памяти.
+var outboxPath string
+
 func init() {
 	orchestratorURL = os.Getenv("ORCHESTRATOR_URL")
 	if orchestratorURL == "" {
 		orchestratorURL = "http://orchestrator:8080"
 	}
+	orchestratorGRPCAddr = os.Getenv("ORCHESTRATOR_GRPC_ADDR")
+	if orchestratorGRPCAddr == "" {
+		orchestratorGRPCAddr = "orchestrator:9090"
+	}
+	agentID = os.Getenv("AGENT_ID")
+	if agentID == "" {
+		hostname, _ := os.Hostname()
+		agentID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	for _, op := range strings.Split(os.Getenv("AGENT_OPERATIONS"), ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			agentOperations = append(agentOperations, op)
+		}
+	}
+	if valStr := os.Getenv("TASK_WAIT"); valStr != "" {
+		val, err := time.ParseDuration(valStr)
+		if err != nil || val < 0 {
+			log.Printf("Ошибка преобразования TASK_WAIT: %q", valStr)
+		} else {
+			taskWait = val
+		}
+	}
+	if valStr := os.Getenv("AGENT_BATCH_SIZE"); valStr != "" {
+		val, err := strconv.Atoi(valStr)
+		if err != nil || val < 1 {
+			log.Printf("Ошибка преобразования AGENT_BATCH_SIZE: %q", valStr)
+		} else {
+			batchSize = val
+		}
+	}
+	for name, target := range map[string]*time.Duration{"AGENT_RETRY_BASE": &retryBase, "AGENT_RETRY_MAX": &retryMax} {
+		if valStr := os.Getenv(name); valStr != "" {
+			val, err := time.ParseDuration(valStr)
+			if err != nil || val <= 0 {
+				log.Printf("Ошибка преобразования %s: %q", name, valStr)
+			} else {
+				*target = val
+			}
+		}
+	}
+	outboxPath = os.Getenv("AGENT_OUTBOX_PATH")
+}
+
+// Transport — способ обмена задачами и результатами с оркестратором.
+type Transport interface {
+	// Fetch возвращает следующую задачу или nil, если задач пока нет.
+	// Ожидание прерывается отменой ctx.
+	Fetch(ctx context.Context) (*models.Task, error)
+	// Submit отправляет оркестратору результат задачи.
+	Submit(res models.Result) error
+	// Close освобождает соединения транспорта после остановки рабочих.
+	Close() error
+}
+
+// NewTransportFromEnv создаёт транспорт, выбранный переменной окружения
+// AGENT_TRANSPORT: "http" (по умолчанию, опрос /internal/task), "stream"
+// (постоянное HTTP-соединение) или "grpc". capacity — число рабочих горутин.
+// Для "http" при AGENT_BATCH_SIZE > 1 задачи и результаты передаются пакетами.
+// Результаты отправляются через Outbox, сохраняемый в AGENT_OUTBOX_PATH.
+func NewTransportFromEnv(capacity int) Transport {
+	outbox, err := NewOutbox(newTransport(capacity), outboxPath)
+	if err != nil {
+		log.Printf("Ошибка при загрузке неотправленных результатов из %s: %v", outboxPath, err)
+	}
+	return outbox
+}
+
+func newTransport(capacity int) Transport {
+	switch mode := os.Getenv("AGENT_TRANSPORT"); mode {
+	case "stream":
+		return NewStreamTransport(orchestratorURL, agentID, agentOperations, capacity)
+	case "grpc":
+		return NewGRPCTransport(orchestratorGRPCAddr, agentID, agentOperations, capacity)
+	default:
+		if mode != "" && mode != "http" {
+			log.Printf("Неизвестный транспорт %q, используется http", mode)
+		}
+		if batchSize > 1 {
+			return NewBatchTransport(orchestratorURL, agentID, agentOperations, taskWait, batchSize)
+		}
+		return NewHTTPTransport(orchestratorURL, agentID, agentOperations, taskWait)
+	}
 }
 
-func StartWorkers(count int) {
+// StartWorkers запускает count рабочих горутин. После отмены ctx рабочие
+// не берут новых задач, а текущие доводят до конца и отправляют результат;
+// возвращаемый канал закрывается, когда завершатся все рабочие.
+func StartWorkers(ctx context.Context, count int, transport Transport) <-chan struct{} {
+	var wg sync.WaitGroup
 	for i := 0; i < count; i++ {
-		go worker(i + 1)
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			worker(ctx, id, transport)
+		}(i + 1)
 	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
 }
 
-func worker(id int) {
+func worker(ctx context.Context, id int, transport Transport) {
 	log.Printf("Агент #%d запущен", id)
-	for {
-		task, err := fetchTask()
+	backoff := NewBackoff()
+	for ctx.Err() == nil {
+		task, err := transport.Fetch(ctx)
+		if ctx.Err() != nil {
+			if task != nil {
+				// Задача уже получена — выполняем её, а не бросаем.
+				submit(id, transport, execute(id, task))
+			}
+			break
+		}
 		if err != nil {
-			log.Printf("Агент #%d: ошибка при получении задачи: %v", id, err)
-			time.Sleep(2 * time.Second)
+			delay := backoff.Next()
+			log.Printf("Агент #%d: ошибка при получении задачи, повтор через %s: %v", id, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
 			continue
 		}
+		backoff.Reset()
 		if task == nil {
-			time.Sleep(2 * time.Second)
 			continue
 		}
-		log.Printf("Агент #%d получил задачу: %+v", id, task)
-
-		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+		submit(id, transport, execute(id, task))
+	}
+	log.Printf("Агент #%d остановлен", id)
+}
 
-		result, err := compute(task)
-		if err != nil {
-			log.Printf("Агент #%d: ошибка при вычислении задачи %s: %v", id, task.ID, err)
-			sendResult(task.ID, 0, err.Error())
-		} else {
-			log.Printf("Агент #%d вычислил результат задачи %s: %f", id, task.ID, result)
-			sendResult(task.ID, result, "")
-		}
+func submit(id int, transport Transport, res models.Result) {
+	if err := transport.Submit(res); err != nil {
+		log.Printf("Агент #%d: ошибка при отправке результата задачи %s: %v", id, res.ID, err)
 	}
 }
 
-func fetchTask() (*models.Task, error) {
-	url := fmt.Sprintf("%s/internal/task", orchestratorURL)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+// execute выполняет задачу с искусственной задержкой и формирует результат.
+func execute(id int, task *models.Task) models.Result {
+	log.Printf("Агент #%d получил задачу: %+v", id, task)
+	if task.Subtree != nil {
+		return executeSubtree(id, task)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
+	time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+
+	result, err := compute(task)
+	if err != nil {
+		log.Printf("Агент #%d: ошибка при вычислении задачи %s: %v", id, task.ID, err)
+		return models.Result{ID: task.ID, Error: err.Error()}
 	}
+	log.Printf("Агент #%d вычислил результат задачи %s: %f", id, task.ID, result)
+	return models.Result{ID: task.ID, Result: result}
+}
 
-	var response struct {
-		Task models.Task `json:"task"`
+// executeSubtree вычисляет объединённое поддерево снизу вверх, имитируя
+// задержку каждой операции, и сообщает результат и время каждого узла.
+func executeSubtree(id int, task *models.Task) models.Result {
+	res := models.Result{ID: task.ID}
+	var eval func(node *models.TaskNode) (float64, error)
+	eval = func(node *models.TaskNode) (float64, error) {
+		if node.Operation == "" {
+			return node.Value, nil
+		}
+		if node.Left == nil || node.Right == nil {
+			return 0, fmt.Errorf("у операции %s нет аргументов", node.ID)
+		}
+		left, err := eval(node.Left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := eval(node.Right)
+		if err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		time.Sleep(time.Duration(node.OperationTime) * time.Millisecond)
+		value, err := compute(&models.Task{Arg1: left, Arg2: right, Operation: node.Operation})
+		if err != nil {
+			return 0, err
+		}
+		res.Timings = append(res.Timings, models.NodeTiming{ID: node.ID, Result: value, Duration: time.Since(start)})
+		return value, nil
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+
+	result, err := eval(task.Subtree)
+	if err != nil {
+		log.Printf("Агент #%d: ошибка при вычислении поддерева %s: %v", id, task.ID, err)
+		res.Error = err.Error()
+		return res
 	}
-	return &response.Task, nil
+	log.Printf("Агент #%d вычислил поддерево %s из %d операций: %f", id, task.ID, len(res.Timings), result)
+	res.Result = result
+	return res
 }
 
 func compute(task *models.Task) (float64, error) {
@@ -93,19 +266,3 @@ func compute(task *models.Task) (float64, error) {
 		return 0, fmt.Errorf("неподдерживаемая операция: %s", task.Operation)
 	}
 }
-
-func sendResult(taskID string, result float64, errMsg string) error {
-	res := models.Result{
-		ID:     taskID,
-		Result: result,
-		Error:  errMsg,
-	}
-	data, _ := json.Marshal(res)
-	url := fmt.Sprintf("%s/internal/task/result", orchestratorURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
-}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// AgentIDHeader — заголовок, которым агент сообщает оркестратору свой
+// идентификатор при получении задач и отправке результатов по HTTP.
+const AgentIDHeader = "X-Agent-ID"
+
+// Состояния агента.
+const (
+	AgentAlive = "alive"
+	AgentDead  = "dead"
+	AgentLeft  = "left" // агент завершил работу и вернул свои задачи
+)
+
+// AgentInfo — сведения, которые агент сообщает при регистрации.
+type AgentInfo struct {
+	ID             string `json:"id"`
+	Hostname       string `json:"hostname"`
+	ComputingPower int    `json:"computing_power"`
+	Version        string `json:"version"`
+	// Operations — поддерживаемые агентом операции; пустой список — все.
+	Operations []string `json:"operations,omitempty"`
+}
+
+// Agent описывает зарегистрированного агента и статистику его работы.
+type Agent struct {
+	AgentInfo
+	Status        string    `json:"status"`
+	RegisteredAt  time.Time `json:"registered_at"`
+	LastSeen      time.Time `json:"last_seen"`
+	TasksInFlight int       `json:"tasks_in_flight"`
+	Completed     int       `json:"completed"`
+	Errors        int       `json:"errors"`
+	ErrorRate     float64   `json:"error_rate"`
+}
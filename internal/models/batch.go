@@ -0,0 +1,16 @@
+package models
+
+// BatchProgress — общий ход вычисления выражений пакета.
+type BatchProgress struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+	// Statuses — число выражений пакета в каждом статусе.
+	Statuses map[ExpressionStatus]int `json:"statuses"`
+	// TotalNodes и ComputedNodes — сумма операций всех выражений пакета и
+	// число уже вычисленных из них.
+	TotalNodes    int `json:"total_nodes"`
+	ComputedNodes int `json:"computed_nodes"`
+	// Finished — все выражения пакета в конечном статусе.
+	Finished    bool     `json:"finished"`
+	Expressions []string `json:"expressions"`
+}
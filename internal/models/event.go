@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Типы событий журнала выражения.
+const (
+	EventSubmitted      = "submitted"       // выражение принято
+	EventTaskScheduled  = "task_scheduled"  // задача поставлена в очередь
+	EventTaskDispatched = "task_dispatched" // задача выдана агенту
+	EventTaskRequeued   = "task_requeued"   // задача возвращена в очередь
+	EventResultReceived = "result_received" // результат задачи принят
+	EventResultRejected = "result_rejected" // результат задачи отклонён
+	EventError          = "error"           // выражение завершилось ошибкой
+	EventCompleted      = "completed"       // выражение вычислено
+	EventTimeout        = "timeout"         // выражение не вычислено в срок
+	EventWebhook        = "webhook"         // изменилось состояние отправки уведомления
+	EventCompacted      = "compacted"       // итоговое состояние завершённого выражения после сжатия журнала
+)
+
+// Event — запись журнала изменений состояния оркестратора.
+type Event struct {
+	Seq          uint64    `json:"seq"`
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	ExpressionID string    `json:"expression_id"`
+	TaskID       string    `json:"task_id,omitempty"`
+	AgentID      string    `json:"agent_id,omitempty"`
+
+	// Text — текст выражения (для EventSubmitted).
+	Text string `json:"text,omitempty"`
+	// Expression — состояние выражения после события (для EventSubmitted,
+	// событий завершения, EventWebhook и EventCompacted).
+	Expression *Expression `json:"expression,omitempty"`
+	Task       *Task       `json:"task,omitempty"`
+	Result     *Result     `json:"result,omitempty"`
+	Ack        *ResultAck  `json:"ack,omitempty"`
+}
@@ -1,13 +1,93 @@
 package models
 
+import "time"
+
+// Коды ошибок выражения.
+const (
+	ErrorCodeEvaluation = "evaluation_error" // агент не смог вычислить операцию
+	ErrorCodeTimeout    = "timeout"          // выражение не вычислено в срок
+)
+
 type Expression struct {
-	ID     string   `json:"id"`
-	Status string   `json:"status"`
-	Result *float64 `json:"result,omitempty"`
+	ID        string           `json:"id"`
+	Text      string           `json:"text,omitempty"` // исходный текст выражения
+	Status    ExpressionStatus `json:"status"`
+	Result    *float64         `json:"result,omitempty"`
+	ErrorCode string           `json:"error_code,omitempty"`
+	Error     string           `json:"error,omitempty"` // текст ошибки вычисления
+	Priority  int              `json:"priority,omitempty"`
+	Deadline  *time.Time       `json:"deadline,omitempty"` // срок, заданный клиентом
+	CreatedAt time.Time        `json:"created_at"`
+	// StartedAt — когда первая задача выражения выдана агенту.
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// TimeoutAt — когда истекает время вычисления (MAX_EVALUATION_TIME или
+	// timeout запроса). В отличие от Deadline не влияет на планирование.
+	TimeoutAt *time.Time `json:"timeout_at,omitempty"`
+
+	// TotalNodes и ComputedNodes — число операций в дереве выражения и
+	// число уже вычисленных из них.
+	TotalNodes    int `json:"total_nodes"`
+	ComputedNodes int `json:"computed_nodes"`
+
+	// CallbackURL — адрес, на который отправляется выражение после
+	// завершения вычисления; Webhook — состояние этой отправки.
+	CallbackURL string           `json:"callback_url,omitempty"`
+	Webhook     *WebhookDelivery `json:"webhook,omitempty"`
+
+	// Variables — значения переменных, подставленные в текст выражения.
+	Variables map[string]float64 `json:"variables,omitempty"`
+	// BatchID — пакет, в составе которого отправлено выражение.
+	BatchID string `json:"batch_id,omitempty"`
+}
+
+// Состояния отправки уведомления о завершении выражения.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery описывает отправку уведомления о завершении выражения.
+type WebhookDelivery struct {
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Overdue сообщает, что к моменту now истёк срок вычисления выражения:
+// заданный клиентом Deadline или ограничение времени TimeoutAt.
+func (e *Expression) Overdue(now time.Time) bool {
+	return (e.Deadline != nil && !now.Before(*e.Deadline)) ||
+		(e.TimeoutAt != nil && !now.Before(*e.TimeoutAt))
+}
+
+// IsActive сообщает, что выражение ещё вычисляется.
+func (e *Expression) IsActive() bool {
+	return e.Status == StatusPending || e.Status == StatusInProgress
 }
 
 type Result struct {
 	ID     string  `json:"id"`
 	Result float64 `json:"result"`
 	Error  string  `json:"error,omitempty"`
+
+	// Timings — результаты и время вычисления отдельных узлов объединённого
+	// поддерева (см. Task.Subtree).
+	Timings []NodeTiming `json:"timings,omitempty"`
+}
+
+// NodeTiming описывает вычисление одного узла поддерева на агенте.
+type NodeTiming struct {
+	ID       string        `json:"id"`
+	Result   float64       `json:"result"`
+	Duration time.Duration `json:"duration"` // в наносекундах
+}
+
+// ResultAck — подтверждение оркестратора на результат задачи.
+type ResultAck struct {
+	ID      string `json:"id"`
+	Status  int    `json:"status"` // HTTP-статус, с которым принят результат
+	Message string `json:"message"`
 }
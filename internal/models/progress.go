@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Типы событий хода вычисления, передаваемых клиентам (Server-Sent Events).
+const (
+	ProgressNodeCompleted = "node_completed" // вычислена операция дерева
+	ProgressStatusChanged = "status_changed" // изменился статус выражения
+	ProgressResult        = "result"         // вычисление завершено
+)
+
+// ProgressEvent — событие хода вычисления выражения.
+type ProgressEvent struct {
+	ID           uint64    `json:"id"`
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	ExpressionID string    `json:"expression_id"`
+
+	// NodeID и Value — вычисленная операция и её результат (для
+	// ProgressNodeCompleted).
+	NodeID string   `json:"node_id,omitempty"`
+	Value  *float64 `json:"value,omitempty"`
+	// Expression — состояние выражения после события.
+	Expression *Expression `json:"expression,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "fmt"
+
+// ExpressionStatus — статус вычисления выражения.
+type ExpressionStatus string
+
+const (
+	StatusPending    ExpressionStatus = "pending"     // принято, задачи ещё не выдавались
+	StatusInProgress ExpressionStatus = "in_progress" // хотя бы одна задача выдана агенту
+	StatusCompleted  ExpressionStatus = "completed"   // вычислено
+	StatusError      ExpressionStatus = "error"       // агент вернул ошибку
+	StatusCancelled  ExpressionStatus = "cancelled"   // вычисление отменено
+	StatusTimeout    ExpressionStatus = "timeout"     // не вычислено в срок
+)
+
+// Statuses перечисляет все статусы выражения.
+var Statuses = []ExpressionStatus{
+	StatusPending, StatusInProgress, StatusCompleted, StatusError, StatusCancelled, StatusTimeout,
+}
+
+// statusTransitions — допустимые переходы между статусами. Из завершающих
+// статусов переходов нет.
+var statusTransitions = map[ExpressionStatus][]ExpressionStatus{
+	StatusPending:    {StatusInProgress, StatusError, StatusCancelled, StatusTimeout},
+	StatusInProgress: {StatusCompleted, StatusError, StatusCancelled, StatusTimeout},
+}
+
+// Valid сообщает, что статус известен.
+func (s ExpressionStatus) Valid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal сообщает, что вычисление выражения завершено.
+func (s ExpressionStatus) IsTerminal() bool {
+	return s.Valid() && len(statusTransitions[s]) == 0
+}
+
+// CanTransition сообщает, допустим ли переход из статуса from в статус to.
+func CanTransition(from, to ExpressionStatus) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition переводит выражение в статус to, если переход допустим.
+func (e *Expression) Transition(to ExpressionStatus) error {
+	if !CanTransition(e.Status, to) {
+		return fmt.Errorf("недопустимый переход выражения %s: %s → %s", e.ID, e.Status, to)
+	}
+	e.Status = to
+	return nil
+}
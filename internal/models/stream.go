@@ -0,0 +1,20 @@
+package models
+
+// StreamProtocol — подпротокол WebSocket (Sec-WebSocket-Protocol), по
+// которому агент получает задачи в режиме push.
+const StreamProtocol = "calc-tasks"
+
+// Типы сообщений потокового протокола между агентом и оркестратором.
+const (
+	StreamTask   = "task"
+	StreamResult = "result"
+)
+
+// StreamMessage описывает сообщение постоянного соединения агента с
+// оркестратором: оркестратор отправляет задачи, агент — результаты.
+// Каждое сообщение передаётся отдельным текстовым кадром WebSocket в виде JSON.
+type StreamMessage struct {
+	Type   string  `json:"type"`
+	Task   *Task   `json:"task,omitempty"`
+	Result *Result `json:"result,omitempty"`
+}
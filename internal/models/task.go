@@ -1,12 +1,53 @@
 // internal/models/task.go
 package models
 
+import "time"
+
 // Task описывает отдельную арифметическую операцию, которую необходимо вычислить.
 type Task struct {
 	ID            string  `json:"id"`
+	ExpressionID  string  `json:"expression_id"`
 	Arg1          float64 `json:"arg1"`
 	Arg2          float64 `json:"arg2"`
 	Operation     string  `json:"operation"`
 	OperationTime int     `json:"operation_time"` // время выполнения операции в мс
 	Priority      int     `json:"priority"`       // приоритет вычисления (чем выше значение, тем приоритетнее)
+
+	ExpressionPriority int        `json:"expression_priority,omitempty"` // приоритет выражения, заданный клиентом
+	Deadline           *time.Time `json:"deadline,omitempty"`            // срок, до которого выражение должно быть вычислено
+
+	// Subtree — объединённое поддерево выражения, которое агент вычисляет
+	// целиком. Корень поддерева совпадает с узлом задачи, а OperationTime
+	// содержит суммарное время всех его операций.
+	Subtree *TaskNode `json:"subtree,omitempty"`
+}
+
+// TaskNode — узел поддерева, передаваемого агенту. У листьев Operation
+// пустая, а значение хранится в Value.
+type TaskNode struct {
+	ID            string    `json:"id,omitempty"`
+	Operation     string    `json:"operation,omitempty"`
+	OperationTime int       `json:"operation_time,omitempty"` // время выполнения операции в мс
+	Value         float64   `json:"value,omitempty"`
+	Left          *TaskNode `json:"left,omitempty"`
+	Right         *TaskNode `json:"right,omitempty"`
+}
+
+// Operations возвращает операции, которые нужно выполнить для задачи.
+func (t *Task) Operations() []string {
+	if t.Subtree == nil {
+		return []string{t.Operation}
+	}
+	var ops []string
+	var walk func(node *TaskNode)
+	walk = func(node *TaskNode) {
+		if node == nil || node.Operation == "" {
+			return
+		}
+		ops = append(ops, node.Operation)
+		walk(node.Left)
+		walk(node.Right)
+	}
+	walk(t.Subtree)
+	return ops
 }
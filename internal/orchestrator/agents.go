@@ -0,0 +1,289 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// dispatch — задача, выданная агенту и ожидающая результата.
+type dispatch struct {
+	task    *models.Task
+	agentID string
+	at      time.Time
+}
+
+func (s *Server) handleAgentRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	var info models.AgentInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil || info.ID == "" {
+		http.Error(w, "Неверный формат данных агента", http.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now()
+	s.AgentsMutex.Lock()
+	agent, ok := s.Agents[info.ID]
+	if !ok {
+		agent = &models.Agent{RegisteredAt: now}
+		s.Agents[info.ID] = agent
+	}
+	agent.AgentInfo = info
+	agent.Status = models.AgentAlive
+	agent.LastSeen = now
+	view := s.agentView(agent)
+	s.AgentsMutex.Unlock()
+
+	log.Printf("Агент %s зарегистрирован: %s, %d горутин, версия %s, операции %v", info.ID, info.Hostname, info.ComputingPower, info.Version, info.Operations)
+	json.NewEncoder(w).Encode(map[string]interface{}{"agent": view})
+}
+
+func (s *Server) handleAgentHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == "" {
+		http.Error(w, "Неверный формат данных агента", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.AgentsMutex.Lock()
+	defer s.AgentsMutex.Unlock()
+	agent, ok := s.Agents[input.ID]
+	if !ok {
+		http.Error(w, "Агент не зарегистрирован", http.StatusNotFound)
+		return
+	}
+	if agent.Status != models.AgentAlive {
+		log.Printf("Агент %s снова на связи", agent.ID)
+	}
+	agent.Status = models.AgentAlive
+	agent.LastSeen = time.Now()
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleAgentDeregister снимает агента с работы при его остановке: задачи,
+// выданные агенту и оставшиеся без результата, сразу возвращаются в очередь.
+func (s *Server) handleAgentDeregister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == "" {
+		http.Error(w, "Неверный формат данных агента", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.AgentsMutex.Lock()
+	agent, ok := s.Agents[input.ID]
+	if !ok {
+		s.AgentsMutex.Unlock()
+		http.Error(w, "Агент не зарегистрирован", http.StatusNotFound)
+		return
+	}
+	agent.Status = models.AgentLeft
+	orphaned := s.dispatchedTo(input.ID)
+	s.AgentsMutex.Unlock()
+
+	for _, d := range orphaned {
+		s.requeueDispatch(d)
+	}
+	log.Printf("Агент %s завершил работу, возвращено задач в очередь: %d", input.ID, len(orphaned))
+	json.NewEncoder(w).Encode(map[string]int{"requeued": len(orphaned)})
+}
+
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	s.AgentsMutex.Lock()
+	agents := make([]models.Agent, 0, len(s.Agents))
+	for _, agent := range s.Agents {
+		agents = append(agents, s.agentView(agent))
+	}
+	s.AgentsMutex.Unlock()
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ID < agents[j].ID
+	})
+	json.NewEncoder(w).Encode(map[string]interface{}{"agents": agents})
+}
+
+// agentView возвращает копию агента с вычисленными показателями.
+// Вызывается под s.AgentsMutex.
+func (s *Server) agentView(agent *models.Agent) models.Agent {
+	view := *agent
+	view.TasksInFlight = 0
+	for _, d := range s.dispatched {
+		if d.agentID == agent.ID {
+			view.TasksInFlight++
+		}
+	}
+	if total := view.Completed + view.Errors; total > 0 {
+		view.ErrorRate = float64(view.Errors) / float64(total)
+	}
+	return view
+}
+
+// markDispatched запоминает, что задача выдана агенту agentID, и
+// возвращает запись об этой выдаче.
+func (s *Server) markDispatched(task *models.Task, agentID string) *dispatch {
+	s.Mutex.Lock()
+	s.markStarted(task.ExpressionID, time.Now())
+	s.Mutex.Unlock()
+
+	s.AgentsMutex.Lock()
+	defer s.AgentsMutex.Unlock()
+	d := &dispatch{task: task, agentID: agentID, at: time.Now()}
+	s.dispatched[task.ID] = d
+	if agent, ok := s.Agents[agentID]; ok {
+		agent.LastSeen = time.Now()
+	}
+	s.record(models.Event{Type: models.EventTaskDispatched, ExpressionID: task.ExpressionID, TaskID: task.ID, AgentID: agentID})
+	return d
+}
+
+// completeDispatch снимает задачу с учёта выданных и обновляет статистику
+// агента agentID, приславшего результат. Принимается результат агента,
+// которому задача выдана, а также запоздавший результат агента, у которого
+// она была отозвана (перестал присылать пульс, завершил работу или разорвал
+// соединение): тогда задача снимается и с агента, получившего её заново, и
+// из очереди, если ещё не выдана. Возвращает false, если задача агенту не
+// выдавалась. Вызывается под s.Mutex.
+func (s *Server) completeDispatch(agentID string, res models.Result) bool {
+	s.AgentsMutex.Lock()
+	d, dispatched := s.dispatched[res.ID]
+	if !(dispatched && d.agentID == agentID) && !s.wasRevoked(res.ID, agentID) {
+		s.AgentsMutex.Unlock()
+		return false
+	}
+	delete(s.dispatched, res.ID)
+	delete(s.revoked, res.ID)
+	if agent, ok := s.Agents[agentID]; ok {
+		agent.LastSeen = time.Now()
+		if res.Error != "" {
+			agent.Errors++
+		} else {
+			agent.Completed++
+		}
+	}
+	s.AgentsMutex.Unlock()
+
+	if !dispatched {
+		s.QueueMutex.Lock()
+		s.TaskQueue.Remove(func(task *models.Task) bool {
+			return task.ID == res.ID
+		})
+		s.QueueMutex.Unlock()
+	}
+	return true
+}
+
+// wasRevoked сообщает, была ли задача taskID отозвана у агента agentID.
+// Вызывается под s.AgentsMutex.
+func (s *Server) wasRevoked(taskID, agentID string) bool {
+	for _, id := range s.revoked[taskID] {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetRevoked удаляет сведения об отозванных задачах завершённого
+// выражения exprID: их результаты больше не нужны.
+func (s *Server) forgetRevoked(exprID string) {
+	s.AgentsMutex.Lock()
+	defer s.AgentsMutex.Unlock()
+	for taskID := range s.revoked {
+		if strings.HasPrefix(taskID, exprID+"-") {
+			delete(s.revoked, taskID)
+		}
+	}
+}
+
+// reapAgents помечает мёртвыми агентов, не присылавших пульс дольше
+// HeartbeatTimeout, и возвращает в очередь выданные им задачи.
+func (s *Server) reapAgents(now time.Time) {
+	if s.HeartbeatTimeout <= 0 {
+		return
+	}
+	var orphaned []*dispatch
+	s.AgentsMutex.Lock()
+	for id, agent := range s.Agents {
+		if agent.Status != models.AgentAlive || now.Sub(agent.LastSeen) < s.HeartbeatTimeout {
+			continue
+		}
+		agent.Status = models.AgentDead
+		log.Printf("Агент %s не присылал пульс с %s, помечен как недоступный", id, agent.LastSeen.Format(time.RFC3339))
+		orphaned = append(orphaned, s.dispatchedTo(id)...)
+	}
+	s.AgentsMutex.Unlock()
+
+	for _, d := range orphaned {
+		s.requeueDispatch(d)
+	}
+}
+
+// dispatchedTo возвращает выдачи агенту agentID, оставшиеся без
+// результата. Вызывается под s.AgentsMutex.
+func (s *Server) dispatchedTo(agentID string) []*dispatch {
+	var orphaned []*dispatch
+	for _, d := range s.dispatched {
+		if d.agentID == agentID {
+			orphaned = append(orphaned, d)
+		}
+	}
+	return orphaned
+}
+
+// parseOperations разбирает список операций вида "+,-".
+func parseOperations(list string) []string {
+	var ops []string
+	for _, op := range strings.Split(list, ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// taskFilter возвращает условие отбора задач для агента: явно переданный
+// список операций ops, а при его отсутствии — операции, заявленные агентом
+// при регистрации. nil означает, что агент выполняет любые операции.
+func (s *Server) taskFilter(agentID string, ops []string) func(*models.Task) bool {
+	if len(ops) == 0 && agentID != "" {
+		s.AgentsMutex.Lock()
+		if agent, ok := s.Agents[agentID]; ok {
+			ops = agent.Operations
+		}
+		s.AgentsMutex.Unlock()
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	supported := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		supported[op] = true
+	}
+	return func(task *models.Task) bool {
+		for _, op := range task.Operations() {
+			if !supported[op] {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,159 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// maxBatchSize ограничивает число выражений в одном пакете.
+const maxBatchSize = 1000
+
+// batchItem — итог приёма одного выражения пакета: ID принятого выражения
+// или текст ошибки проверки.
+type batchItem struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleCalculateBatch принимает пакет выражений. Каждое проверяется
+// отдельно: ошибка в одном не мешает принять остальные. Принятые выражения
+// получают общий ID пакета, по которому доступен общий ход вычисления.
+func (s *Server) handleCalculateBatch(w http.ResponseWriter, r *http.Request) {
+	if s.shuttingDown() {
+		http.Error(w, "Сервер останавливается", http.StatusServiceUnavailable)
+		return
+	}
+	var input struct {
+		Expressions []calculateRequest `json:"expressions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Неверный формат запроса", http.StatusUnprocessableEntity)
+		return
+	}
+	if len(input.Expressions) == 0 {
+		http.Error(w, "Пакет не содержит выражений", http.StatusUnprocessableEntity)
+		return
+	}
+	if len(input.Expressions) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("В пакете больше %d выражений", maxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now()
+	items := make([]batchItem, len(input.Expressions))
+	exprs := make([]*models.Expression, len(input.Expressions))
+	asts := make([]*parser.Node, len(input.Expressions))
+	accepted := 0
+	for i, req := range input.Expressions {
+		items[i].Index = i
+		expr, ast, err := s.prepareExpression(req, now)
+		if err != nil {
+			items[i].Error = err.Error()
+			continue
+		}
+		exprs[i], asts[i] = expr, ast
+		accepted++
+	}
+	if accepted == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+		return
+	}
+
+	s.Mutex.Lock()
+	batchID := s.newBatchID(now)
+	for i, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		expr.BatchID = batchID
+		items[i].ID = s.addExpression(expr, asts[i])
+	}
+	s.Mutex.Unlock()
+
+	log.Printf("Пакет %s принят: выражений %d, отклонено %d", batchID, accepted, len(items)-accepted)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"batch_id": batchID, "items": items})
+}
+
+// handleBatch возвращает общий ход вычисления выражений пакета.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/batches/")
+	progress, ok := s.batchProgress(id)
+	if !ok {
+		http.Error(w, "Пакет не найден", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"batch": progress})
+}
+
+// batchProgress собирает ход вычисления пакета по его выражениям.
+func (s *Server) batchProgress(id string) (models.BatchProgress, bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	ids, ok := s.batches[id]
+	if !ok {
+		return models.BatchProgress{}, false
+	}
+	progress := models.BatchProgress{
+		ID:          id,
+		Statuses:    make(map[models.ExpressionStatus]int),
+		Finished:    true,
+		Expressions: append([]string(nil), ids...),
+	}
+	for _, exprID := range ids {
+		expr, ok := s.Expressions[exprID]
+		if !ok {
+			continue
+		}
+		progress.Total++
+		progress.Statuses[expr.Status]++
+		progress.TotalNodes += expr.TotalNodes
+		progress.ComputedNodes += expr.ComputedNodes
+		if !expr.Status.IsTerminal() {
+			progress.Finished = false
+		}
+	}
+	return progress, true
+}
+
+// newBatchID возвращает уникальный ID пакета. Вызывается под s.Mutex.
+func (s *Server) newBatchID(now time.Time) string {
+	return s.batchIDs.next("batch-"+now.Format("20060102150405"), func(id string) bool {
+		_, exists := s.batches[id]
+		return exists
+	})
+}
+
+// addToBatch добавляет выражение в его пакет. Каждое выражение добавляется
+// один раз: при приёме, импорте (существующие ID пропускаются) или
+// восстановлении пакетов заново. Вызывается под s.Mutex.
+func (s *Server) addToBatch(expr *models.Expression) {
+	if expr.BatchID == "" {
+		return
+	}
+	s.batches[expr.BatchID] = append(s.batches[expr.BatchID], expr.ID)
+}
+
+// rebuildBatches восстанавливает состав пакетов по выражениям после
+// загрузки состояния. Вызывается под s.Mutex.
+func (s *Server) rebuildBatches() {
+	s.batches = make(map[string][]string)
+	ids := make([]string, 0, len(s.Expressions))
+	for id := range s.Expressions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s.addToBatch(s.Expressions[id])
+	}
+}
@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationFromEnv читает длительность из переменной окружения в формате
+// time.ParseDuration, возвращая def при её отсутствии или ошибке.
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	valStr := os.Getenv(name)
+	if valStr == "" {
+		return def
+	}
+	val, err := time.ParseDuration(valStr)
+	if err != nil || val < 0 {
+		log.Printf("Ошибка преобразования %s: %q", name, valStr)
+		return def
+	}
+	return val
+}
+
+// intFromEnv читает целое число из переменной окружения, возвращая def при
+// её отсутствии или ошибке.
+func intFromEnv(name string, def int) int {
+	valStr := os.Getenv(name)
+	if valStr == "" {
+		return def
+	}
+	val, err := strconv.Atoi(valStr)
+	if err != nil {
+		log.Printf("Ошибка преобразования %s: %q", name, valStr)
+		return def
+	}
+	return val
+}
+
+// netsFromEnv читает из переменной окружения список сетей CIDR через запятую,
+// пропуская записи с ошибкой.
+func netsFromEnv(name string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("Ошибка преобразования %s: %q", name, item)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,63 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// maxSyncWait ограничивает время, на которое клиент может удерживать
+// запрос /api/v1/calculate в ожидании результата.
+const maxSyncWait = time.Minute
+
+// parseSyncWait разбирает параметр wait запроса на вычисление.
+func parseSyncWait(r *http.Request) (time.Duration, bool) {
+	waitStr := r.URL.Query().Get("wait")
+	if waitStr == "" {
+		return 0, true
+	}
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil || wait < 0 {
+		return 0, false
+	}
+	if wait > maxSyncWait {
+		wait = maxSyncWait
+	}
+	return wait, true
+}
+
+// awaitResult ждёт завершения вычисления выражения exprID не дольше wait.
+// Завершённое выражение возвращается целиком со статусом 200, иначе —
+// только его ID со статусом 202, и клиент продолжает опрос.
+func (s *Server) awaitResult(w http.ResponseWriter, r *http.Request, exprID string, wait time.Duration) {
+	// Подписка оформляется до проверки статуса, чтобы не пропустить итог.
+	sub := s.progress.subscribe(exprID, models.ProgressResult)
+	defer s.progress.unsubscribe(sub)
+
+	s.Mutex.Lock()
+	expr := *s.Expressions[exprID]
+	s.Mutex.Unlock()
+	if !expr.Status.IsTerminal() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case ev, ok := <-sub.events:
+			if ok {
+				expr = *ev.Expression
+			}
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+		}
+	}
+
+	if !expr.Status.IsTerminal() {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"id": exprID})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": exprID, "expression": expr})
+}
@@ -0,0 +1,470 @@
+package orchestrator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/fsutil"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// EventLog — журнал изменений состояния, в который события только
+// дописываются. События хранятся в памяти по выражениям и, если журнал
+// открыт на файле, дописываются в него по одному JSON-объекту на строку.
+// Запись в файл идёт в фоне пачками: Append только ставит событие в очередь.
+type EventLog struct {
+	// MaxFinished — для скольких последних завершённых выражений события
+	// хранятся в памяти (EVENT_LOG_KEEP_FINISHED); события более старых
+	// остаются только в файле. 0 — без ограничения.
+	MaxFinished int
+
+	mu       sync.Mutex
+	seq      uint64
+	byExpr   map[string][]models.Event
+	finished []string
+	path     string
+	file     *os.File
+	w        *bufio.Writer
+	// pending — события, ещё не записанные в файл.
+	pending []models.Event
+	wake    chan struct{}
+	done    chan struct{}
+	// wmu удерживается на время записи пачки событий, чтобы сжатие не
+	// подменило файл посреди записи. Берётся раньше mu.
+	wmu sync.Mutex
+}
+
+// NewEventLog создаёт журнал, хранящийся только в памяти.
+func NewEventLog() *EventLog {
+	return &EventLog{
+		MaxFinished: intFromEnv("EVENT_LOG_KEEP_FINISHED", 1000),
+		byExpr:      make(map[string][]models.Event),
+	}
+}
+
+// Append присваивает событию номер и время и добавляет его в журнал.
+func (l *EventLog) Append(ev models.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	ev.Seq = l.seq
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	l.keep(ev)
+	if l.wake == nil {
+		return
+	}
+	l.pending = append(l.pending, ev)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// keep сохраняет событие в памяти и вытесняет события самых старых
+// завершённых выражений сверх MaxFinished. Вызывается под l.mu.
+func (l *EventLog) keep(ev models.Event) {
+	events, ok := l.byExpr[ev.ExpressionID]
+	if !ok && ev.Type != models.EventSubmitted && ev.Type != models.EventCompacted {
+		// События выражения уже вытеснены из памяти.
+		return
+	}
+	l.byExpr[ev.ExpressionID] = append(events, ev)
+	if !finishes(ev) {
+		return
+	}
+	l.finished = append(l.finished, ev.ExpressionID)
+	for l.MaxFinished > 0 && len(l.finished) > l.MaxFinished {
+		delete(l.byExpr, l.finished[0])
+		l.finished = l.finished[1:]
+	}
+}
+
+// finishes сообщает, что после события выражение больше не вычисляется.
+func finishes(ev models.Event) bool {
+	switch ev.Type {
+	case models.EventError, models.EventCompleted, models.EventTimeout, models.EventCompacted:
+		return true
+	case models.EventSubmitted:
+		// Импортированное выражение может быть уже завершено.
+		return ev.Expression != nil && !ev.Expression.IsActive()
+	}
+	return false
+}
+
+// Events возвращает события выражения в порядке их записи.
+func (l *EventLog) Events(exprID string) []models.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.Event(nil), l.byExpr[exprID]...)
+}
+
+// Close дописывает накопленные события и закрывает файл журнала.
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	if l.wake == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	close(l.wake)
+	l.wake = nil
+	done := l.done
+	l.mu.Unlock()
+	<-done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.file.Close()
+	l.file, l.w = nil, nil
+	return err
+}
+
+// load добавляет в журнал прочитанные из файла события без повторной записи.
+func (l *EventLog) load(events []models.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ev := range events {
+		l.keep(ev)
+		if ev.Seq > l.seq {
+			l.seq = ev.Seq
+		}
+	}
+}
+
+// open начинает дописывать события в файл path.
+func (l *EventLog) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path, l.file, l.w = path, file, bufio.NewWriter(file)
+	l.wake, l.done = make(chan struct{}, 1), make(chan struct{})
+	go l.writeLoop(l.wake, l.done)
+	return nil
+}
+
+// writeLoop записывает накопленные события в файл, пока журнал не закрыт.
+func (l *EventLog) writeLoop(wake <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for range wake {
+		l.writePending()
+	}
+	l.writePending()
+}
+
+// writePending записывает в файл все накопленные события и сбрасывает буфер
+// один раз на пачку.
+func (l *EventLog) writePending() {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.mu.Lock()
+	batch, w := l.pending, l.w
+	l.pending = nil
+	l.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	for _, ev := range batch {
+		if err := writeEvent(w, ev); err != nil {
+			log.Printf("Ошибка записи события %d в журнал: %v", ev.Seq, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("Ошибка записи журнала событий: %v", err)
+	}
+}
+
+// writeEvent записывает событие одной строкой JSON.
+func writeEvent(w io.Writer, ev models.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// compact переписывает файл журнала: события выражений из finished
+// заменяются одним событием EventCompacted с их итоговым состоянием,
+// события остальных выражений сохраняются. События в памяти не меняются.
+func (l *EventLog) compact(finished map[string]*models.Expression) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+
+	var kept []models.Event
+	for id, events := range l.byExpr {
+		if _, ok := finished[id]; !ok {
+			kept = append(kept, events...)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Seq < kept[j].Seq })
+	now := time.Now()
+	for id, expr := range finished {
+		l.seq++
+		kept = append(kept, models.Event{Seq: l.seq, Time: now, Type: models.EventCompacted, ExpressionID: id, Expression: expr})
+	}
+
+	var buf bytes.Buffer
+	for _, ev := range kept {
+		if err := writeEvent(&buf, ev); err != nil {
+			return err
+		}
+	}
+	if err := fsutil.WriteFileAtomic(l.path, buf.Bytes()); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file, l.w = file, bufio.NewWriter(file)
+	// Накопленные события уже вошли в новый файл.
+	l.pending = nil
+	log.Printf("Журнал событий %s сжат: событий %d, завершённых выражений %d", l.path, len(kept), len(finished))
+	return nil
+}
+
+// ReadEvents читает журнал событий из файла. Неполная последняя строка
+// (запись, прерванная сбоем) отбрасывается.
+func ReadEvents(path string) ([]models.Event, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []models.Event
+	r := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				log.Printf("Отброшена неполная последняя запись журнала %s", path)
+			}
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var ev models.Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, fmt.Errorf("строка %d журнала %s: %w", line, path, err)
+		}
+		events = append(events, ev)
+	}
+}
+
+// OpenEventLog восстанавливает состояние сервера, воспроизводя журнал
+// событий из файла path, и продолжает дописывать в него новые события.
+// Задачи, не получившие результата до остановки, снова ставятся в очередь.
+func (s *Server) OpenEventLog(path string) error {
+	events, err := ReadEvents(path)
+	if err != nil {
+		return err
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	pending := make(map[string]*models.Task)
+	for _, ev := range events {
+		if err := s.applyEvent(ev, pending); err != nil {
+			return fmt.Errorf("событие %d: %w", ev.Seq, err)
+		}
+	}
+	s.Events.load(events)
+	if err := s.Events.open(path); err != nil {
+		return err
+	}
+
+	// Задачи без результата возвращаются в очередь в порядке постановки, а
+	// агенты, которым они выдавались, могут прислать результат позже.
+	var tasks []*models.Task
+	revoked := make(map[string][]string)
+	for _, ev := range events {
+		switch {
+		case ev.Type == models.EventTaskScheduled && pending[ev.TaskID] == ev.Task:
+			tasks = append(tasks, ev.Task)
+		case ev.Type == models.EventTaskDispatched && pending[ev.TaskID] != nil:
+			revoked[ev.TaskID] = append(revoked[ev.TaskID], ev.AgentID)
+		}
+	}
+	s.index.Reset(s.Expressions)
+	s.rebuildBatches()
+	s.restoreTasks(tasks)
+	s.restoreRevoked(revoked)
+	s.resumeWebhooks()
+	log.Printf("Состояние восстановлено из журнала %s: событий %d, выражений %d, задач без результата %d",
+		path, len(events), len(s.Expressions), len(tasks))
+	return nil
+}
+
+// applyEvent применяет событие журнала к состоянию при воспроизведении.
+// pending — задачи, поставленные в очередь и ещё не получившие результата.
+// Вызывается под s.Mutex.
+func (s *Server) applyEvent(ev models.Event, pending map[string]*models.Task) error {
+	switch ev.Type {
+	case models.EventSubmitted:
+		if ev.Expression == nil {
+			return errors.New("нет данных выражения")
+		}
+		expr := *ev.Expression
+		s.Expressions[ev.ExpressionID] = &expr
+		// Завершённые выражения, загруженные импортом, могут не иметь текста.
+		if ev.Text == "" {
+			return nil
+		}
+		ast, err := parser.ParseExpressionWithVars(ev.Text, ev.Expression.Variables)
+		if err != nil {
+			return err
+		}
+		parser.AssignIDs(ev.ExpressionID, ast)
+		s.ASTs[ev.ExpressionID] = ast
+
+	case models.EventCompacted:
+		if ev.Expression == nil {
+			return errors.New("нет данных выражения")
+		}
+		expr := *ev.Expression
+		s.Expressions[ev.ExpressionID] = &expr
+
+	case models.EventTaskScheduled:
+		if ev.Task == nil {
+			return errors.New("нет данных задачи")
+		}
+		if _, node := s.findNode(ev.TaskID); node != nil {
+			markScheduled(node)
+		}
+		pending[ev.TaskID] = ev.Task
+
+	case models.EventTaskDispatched:
+		s.markStarted(ev.ExpressionID, ev.Time)
+
+	case models.EventResultReceived:
+		if ev.Result == nil || ev.Ack == nil {
+			return errors.New("нет данных результата")
+		}
+		s.rememberAck(*ev.Ack)
+		delete(pending, ev.TaskID)
+		_, node := s.findNode(ev.TaskID)
+		if node == nil || node.Computed || ev.Ack.Status != http.StatusOK || ev.Result.Error != "" {
+			return nil
+		}
+		computed := 1
+		if !node.IsReady() {
+			computed += applySubtreeResult(node, ev.Result.Timings)
+		}
+		node.Value = ev.Result.Result
+		node.Computed = true
+		if expr, ok := s.Expressions[ev.ExpressionID]; ok {
+			expr.ComputedNodes += computed
+		}
+
+	case models.EventError, models.EventCompleted, models.EventTimeout:
+		expr, ok := s.Expressions[ev.ExpressionID]
+		if !ok || ev.Expression == nil {
+			return nil
+		}
+		*expr = *ev.Expression
+
+	case models.EventWebhook:
+		if expr, ok := s.Expressions[ev.ExpressionID]; ok && ev.Expression != nil {
+			expr.Webhook = ev.Expression.Webhook
+		}
+	}
+	return nil
+}
+
+// CompactEventLog сжимает файл журнала событий: историю завершённых
+// выражений заменяет их итоговым состоянием.
+func (s *Server) CompactEventLog() error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	finished := make(map[string]*models.Expression)
+	for id, expr := range s.Expressions {
+		if !expr.IsActive() {
+			copied := *expr
+			finished[id] = &copied
+		}
+	}
+	return s.Events.compact(finished)
+}
+
+// RunEventLogCompaction раз в interval сжимает файл журнала событий.
+// Блокируется до отмены ctx.
+func (s *Server) RunEventLogCompaction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.CompactEventLog(); err != nil {
+				log.Printf("Ошибка при сжатии журнала событий: %v", err)
+			}
+		}
+	}
+}
+
+// record добавляет событие в журнал, а состояние выражения из события
+// сохраняет в хранилище.
+func (s *Server) record(ev models.Event) {
+	s.Events.Append(ev)
+	if s.storeWriter != nil && ev.Expression != nil {
+		s.storeWriter.save(ev.Expression)
+	}
+}
+
+// recordResult добавляет событие о принятом результате и возвращает ответ агенту.
+func (s *Server) recordResult(exprID string, res models.Result, status int, message string) (int, string) {
+	ack := models.ResultAck{ID: res.ID, Status: status, Message: message}
+	s.record(models.Event{Type: models.EventResultReceived, ExpressionID: exprID, TaskID: res.ID, Result: &res, Ack: &ack})
+	return status, message
+}
+
+// recordExpression добавляет событие вместе с текущим состоянием выражения.
+func (s *Server) recordExpression(eventType string, expr *models.Expression) {
+	copied := *expr
+	s.record(models.Event{Type: eventType, ExpressionID: expr.ID, Expression: &copied})
+}
+
+// handleExpressionEvents возвращает журнал событий выражения, а при
+// заголовке Accept: text/event-stream — поток хода его вычисления.
+func (s *Server) handleExpressionEvents(w http.ResponseWriter, r *http.Request, id string) {
+	if wantsEventStream(r) {
+		s.serveProgress(w, r, id)
+		return
+	}
+	s.Mutex.Lock()
+	_, ok := s.Expressions[id]
+	s.Mutex.Unlock()
+	if !ok {
+		http.Error(w, "Выражение не найдено", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": s.Events.Events(id)})
+}
@@ -0,0 +1,389 @@
+package orchestrator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// Форматы выгрузки выражений.
+const (
+	exportJSONL = "jsonl"
+	exportCSV   = "csv"
+)
+
+// exportColumns — столбцы выгрузки в формате CSV.
+var exportColumns = []string{
+	"id", "text", "status", "result", "error_code", "error", "priority",
+	"created_at", "deadline", "started_at", "finished_at", "total_nodes", "computed_nodes",
+	"variables", "batch_id", "timeout_at",
+}
+
+// ImportReport — итог загрузки выгрузки выражений.
+type ImportReport struct {
+	Imported    int           `json:"imported"`
+	Rescheduled int           `json:"rescheduled"`
+	Skipped     int           `json:"skipped"`
+	Errors      []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError описывает запись выгрузки, которую не удалось загрузить.
+type ImportError struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// exportFormat определяет формат по параметру format, а при его отсутствии —
+// по заголовку header (Accept или Content-Type).
+func exportFormat(r *http.Request, header string) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case exportJSONL, exportCSV:
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get(header), "text/csv") {
+			return exportCSV, nil
+		}
+		return exportJSONL, nil
+	default:
+		return "", fmt.Errorf("неизвестный формат: %q", format)
+	}
+}
+
+// handleExport выгружает все выражения в порядке создания: по одному
+// JSON-объекту на строку (по умолчанию) или в формате CSV.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := exportFormat(r, "Accept")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Mutex.Lock()
+	expressions := make([]models.Expression, 0, len(s.Expressions))
+	for _, expr := range s.Expressions {
+		expressions = append(expressions, *expr)
+	}
+	s.Mutex.Unlock()
+	sort.Slice(expressions, func(i, j int) bool {
+		if !expressions[i].CreatedAt.Equal(expressions[j].CreatedAt) {
+			return expressions[i].CreatedAt.Before(expressions[j].CreatedAt)
+		}
+		return expressions[i].ID < expressions[j].ID
+	})
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	if format == exportCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(bw)
+		cw.Write(exportColumns)
+		for i := range expressions {
+			cw.Write(expressionRow(&expressions[i]))
+		}
+		cw.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(bw)
+	for i := range expressions {
+		if err := enc.Encode(&expressions[i]); err != nil {
+			log.Printf("Ошибка выгрузки выражений: %v", err)
+			return
+		}
+	}
+}
+
+func expressionRow(expr *models.Expression) []string {
+	var result, variables string
+	if expr.Result != nil {
+		result = strconv.FormatFloat(*expr.Result, 'g', -1, 64)
+	}
+	if len(expr.Variables) > 0 {
+		data, _ := json.Marshal(expr.Variables)
+		variables = string(data)
+	}
+	return []string{
+		expr.ID, expr.Text, string(expr.Status), result, expr.ErrorCode, expr.Error,
+		strconv.Itoa(expr.Priority), expr.CreatedAt.Format(time.RFC3339Nano),
+		formatTime(expr.Deadline), formatTime(expr.StartedAt), formatTime(expr.FinishedAt),
+		strconv.Itoa(expr.TotalNodes), strconv.Itoa(expr.ComputedNodes),
+		variables, expr.BatchID, formatTime(expr.TimeoutAt),
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime разбирает необязательное время из столбца CSV.
+func parseTime(values map[string]string, column string) (*time.Time, error) {
+	v := values[column]
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, fmt.Errorf("неверное время в столбце %s: %q", column, v)
+	}
+	return &t, nil
+}
+
+// parseCount разбирает необязательное целое число из столбца CSV.
+func parseCount(values map[string]string, column string) (int, error) {
+	v := values[column]
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение в столбце %s: %q", column, v)
+	}
+	return n, nil
+}
+
+func parseExpressionRow(header, row []string) (*models.Expression, error) {
+	values := make(map[string]string, len(header))
+	for i, name := range header {
+		if i < len(row) {
+			values[name] = row[i]
+		}
+	}
+	expr := &models.Expression{
+		ID:        values["id"],
+		Text:      values["text"],
+		Status:    models.ExpressionStatus(values["status"]),
+		ErrorCode: values["error_code"],
+		Error:     values["error"],
+		BatchID:   values["batch_id"],
+	}
+	if v := values["variables"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &expr.Variables); err != nil {
+			return nil, fmt.Errorf("неверные значения переменных: %q", v)
+		}
+	}
+	if v := values["result"]; v != "" {
+		result, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверный результат: %q", v)
+		}
+		expr.Result = &result
+	}
+	var err error
+	if expr.Priority, err = parseCount(values, "priority"); err != nil {
+		return nil, err
+	}
+	if expr.TotalNodes, err = parseCount(values, "total_nodes"); err != nil {
+		return nil, err
+	}
+	if expr.ComputedNodes, err = parseCount(values, "computed_nodes"); err != nil {
+		return nil, err
+	}
+	created, err := parseTime(values, "created_at")
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		expr.CreatedAt = *created
+	}
+	if expr.TimeoutAt, err = parseTime(values, "timeout_at"); err != nil {
+		return nil, err
+	}
+	if expr.Deadline, err = parseTime(values, "deadline"); err != nil {
+		return nil, err
+	}
+	if expr.StartedAt, err = parseTime(values, "started_at"); err != nil {
+		return nil, err
+	}
+	if expr.FinishedAt, err = parseTime(values, "finished_at"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// handleImport загружает выгрузку, полученную из /api/v1/export. Выражения
+// с уже существующими ID пропускаются, завершённые сохраняются как есть, а
+// невычисленные вычисляются заново с начала. Записи, которые не удалось
+// разобрать или загрузить, попадают в отчёт, а импорт продолжается.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.shuttingDown() {
+		http.Error(w, "Сервер останавливается", http.StatusServiceUnavailable)
+		return
+	}
+	format, err := exportFormat(r, "Content-Type")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var report ImportReport
+	read := 0
+	importOne := func(line int, expr *models.Expression, err error) {
+		read++
+		if err == nil {
+			err = s.importExpression(expr, &report)
+		}
+		if err != nil {
+			importErr := ImportError{Line: line, Error: err.Error()}
+			if expr != nil {
+				importErr.ID = expr.ID
+			}
+			report.Errors = append(report.Errors, importErr)
+		}
+	}
+	if format == exportCSV {
+		err = readCSVExport(r.Body, importOne)
+	} else {
+		err = readJSONLExport(r.Body, importOne)
+	}
+	if err != nil {
+		if read == 0 {
+			http.Error(w, "Неверный формат выгрузки: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		// Часть записей уже загружена: сообщаем, где чтение прервалось.
+		report.Errors = append(report.Errors, ImportError{Error: "Выгрузка прочитана не полностью: " + err.Error()})
+	}
+	log.Printf("Импорт выражений: загружено %d, поставлено на вычисление %d, пропущено %d, ошибок %d",
+		report.Imported, report.Rescheduled, report.Skipped, len(report.Errors))
+	json.NewEncoder(w).Encode(report)
+}
+
+// readJSONLExport читает выгрузку JSONL построчно и передаёт importOne каждую
+// непустую строку: разобранное выражение или ошибку разбора. Возвращает
+// только ошибку чтения.
+func readJSONLExport(r io.Reader, importOne func(int, *models.Expression, error)) error {
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("запись %d: %w", line, err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var expr models.Expression
+			if jsonErr := json.Unmarshal(data, &expr); jsonErr != nil {
+				importOne(line, nil, fmt.Errorf("неверная запись: %w", jsonErr))
+			} else {
+				importOne(line, &expr, nil)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// readCSVExport читает выгрузку CSV и передаёт importOne каждую строку:
+// разобранное выражение или ошибку разбора. Возвращает ошибку заголовка или
+// чтения.
+func readCSVExport(r io.Reader, importOne func(int, *models.Expression, error)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			importOne(line, nil, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		expr, err := parseExpressionRow(header, row)
+		importOne(line, expr, err)
+	}
+}
+
+// importExpression добавляет одно выражение из выгрузки.
+func (s *Server) importExpression(expr *models.Expression, report *ImportReport) error {
+	if expr.ID == "" {
+		return errors.New("не указан ID выражения")
+	}
+	if strings.Contains(expr.ID, "/") {
+		return errors.New("недопустимый ID выражения")
+	}
+	if expr.Status != "" && !expr.Status.Valid() {
+		return fmt.Errorf("неизвестный статус: %q", expr.Status)
+	}
+	if expr.Priority < -maxExpressionPriority || expr.Priority > maxExpressionPriority {
+		return fmt.Errorf("недопустимый приоритет: %d", expr.Priority)
+	}
+	finished := expr.Status.IsTerminal()
+	var ast *parser.Node
+	if expr.Text != "" || !finished {
+		var err error
+		if ast, err = parser.ParseExpressionWithVars(expr.Text, expr.Variables); err != nil {
+			return errors.New("неверное арифметическое выражение")
+		}
+		parser.AssignIDs(expr.ID, ast)
+	}
+	if expr.CreatedAt.IsZero() {
+		expr.CreatedAt = time.Now()
+	}
+	if ast != nil && expr.TotalNodes == 0 {
+		expr.TotalNodes, _ = parser.CountOperations(ast)
+	}
+	if !finished {
+		expr.Status = models.StatusPending
+		expr.Result = nil
+		expr.ErrorCode, expr.Error = "", ""
+		expr.StartedAt, expr.FinishedAt = nil, nil
+		expr.ComputedNodes = 0
+		expr.Webhook = nil
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if _, exists := s.Expressions[expr.ID]; exists {
+		report.Skipped++
+		return nil
+	}
+	s.Expressions[expr.ID] = expr
+	if ast != nil {
+		s.ASTs[expr.ID] = ast
+	}
+	s.indexExpression(expr)
+	s.addToBatch(expr)
+	submitted := *expr
+	s.record(models.Event{Type: models.EventSubmitted, ExpressionID: expr.ID, Text: expr.Text, Expression: &submitted})
+	report.Imported++
+	if !finished {
+		s.startEvaluation(expr, ast)
+		report.Rescheduled++
+	}
+	return nil
+}
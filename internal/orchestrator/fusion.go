@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"log"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// subtreeCost возвращает число невычисленных операций поддерева и их
+// суммарное время. ok == false, если в поддереве есть уже запланированный
+// узел: такое поддерево нельзя отдать агенту целиком.
+func subtreeCost(node *parser.Node) (count, opTime int, ok bool) {
+	if node == nil || node.Computed {
+		return 0, 0, true
+	}
+	if node.Scheduled || node.Left == nil || node.Right == nil {
+		return 0, 0, false
+	}
+	leftCount, leftTime, leftOK := subtreeCost(node.Left)
+	rightCount, rightTime, rightOK := subtreeCost(node.Right)
+	return leftCount + rightCount + 1, leftTime + rightTime + parser.GetOperationTime(node.Op), leftOK && rightOK
+}
+
+// canSchedule сообщает, можно ли выдать узел одной задачей: либо он готов к
+// вычислению, либо его поддерево укладывается в пороги объединения
+// FusionMaxNodes и FusionMaxTime.
+func (s *Server) canSchedule(node *parser.Node) bool {
+	count, opTime, ok := subtreeCost(node)
+	if !ok || count == 0 {
+		return false
+	}
+	if count == 1 {
+		return true
+	}
+	return count <= s.FusionMaxNodes && (s.FusionMaxTime <= 0 || opTime <= s.FusionMaxTime)
+}
+
+// scheduleNode ставит в очередь задачу для узла и, если его поддерево
+// содержит несколько операций, передаёт его агенту целиком. Вызывается под s.Mutex.
+func (s *Server) scheduleNode(expr *models.Expression, node *parser.Node) {
+	task := newTask(expr, node)
+	if !node.IsReady() {
+		task.Subtree = toTaskNode(node)
+		task.OperationTime = 0
+		for _, op := range task.Operations() {
+			task.OperationTime += parser.GetOperationTime(op)
+		}
+	}
+	markScheduled(node)
+	s.pushTask(task)
+	s.record(models.Event{Type: models.EventTaskScheduled, ExpressionID: expr.ID, TaskID: task.ID, Task: task})
+	if task.Subtree != nil {
+		log.Printf("Запланирована задача для поддерева %s из %d операций, приоритет %d", node.ID, len(task.Operations()), task.Priority)
+		return
+	}
+	log.Printf("Запланирована задача для узла %s: %f %s %f, приоритет %d", node.ID, node.Left.Value, node.Op, node.Right.Value, task.Priority)
+}
+
+// scheduleParent вызывается после вычисления узла и планирует ближайшего
+// предка, ставшего готовым, поднимаясь выше, пока поддерево укладывается в
+// пороги объединения. Вызывается под s.Mutex.
+func (s *Server) scheduleParent(expr *models.Expression, node *parser.Node) {
+	parent := node.Parent
+	if parent == nil || !s.canSchedule(parent) {
+		return
+	}
+	for parent.Parent != nil && s.canSchedule(parent.Parent) {
+		parent = parent.Parent
+	}
+	s.scheduleNode(expr, parent)
+}
+
+// toTaskNode переводит невычисленную часть поддерева в форму для передачи
+// агенту; вычисленные узлы становятся листьями.
+func toTaskNode(node *parser.Node) *models.TaskNode {
+	if node.Computed {
+		return &models.TaskNode{ID: node.ID, Value: node.Value}
+	}
+	return &models.TaskNode{
+		ID:            node.ID,
+		Operation:     node.Op,
+		OperationTime: parser.GetOperationTime(node.Op),
+		Left:          toTaskNode(node.Left),
+		Right:         toTaskNode(node.Right),
+	}
+}
+
+func markScheduled(node *parser.Node) {
+	if node == nil || node.Computed {
+		return
+	}
+	node.Scheduled = true
+	markScheduled(node.Left)
+	markScheduled(node.Right)
+}
+
+// applySubtreeResult записывает значения внутренних узлов объединённого
+// поддерева из отчёта агента и возвращает число вычисленных так операций.
+// Вызывается под s.Mutex.
+func applySubtreeResult(node *parser.Node, timings []models.NodeTiming) int {
+	computed := 0
+	values := make(map[string]models.NodeTiming, len(timings))
+	for _, timing := range timings {
+		values[timing.ID] = timing
+	}
+	var walk func(node *parser.Node)
+	walk = func(node *parser.Node) {
+		if node == nil || node.Computed {
+			return
+		}
+		walk(node.Left)
+		walk(node.Right)
+		if timing, ok := values[node.ID]; ok {
+			node.Value = timing.Result
+			log.Printf("Узел %s вычислен агентом за %s: %f", node.ID, timing.Duration, timing.Result)
+		}
+		node.Computed = true
+		if node.Op != "" {
+			computed++
+		}
+	}
+	walk(node.Left)
+	walk(node.Right)
+	return computed
+}
@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/taskpb"
+)
+
+// taskService реализует gRPC-версию протокола /internal/task и
+// /internal/task/result поверх того же состояния сервера.
+type taskService struct {
+	taskpb.UnimplementedTaskServiceServer
+	s *Server
+}
+
+// NewGRPCServer создаёт gRPC-сервер с зарегистрированным сервисом задач.
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	gs := grpc.NewServer(opts...)
+	taskpb.RegisterTaskServiceServer(gs, &taskService{s: s})
+	return gs
+}
+
+func (t *taskService) FetchTasks(req *taskpb.FetchTasksRequest, srv taskpb.TaskService_FetchTasksServer) error {
+	capacity := int(req.GetCapacity())
+	if capacity <= 0 {
+		return status.Error(codes.InvalidArgument, "неверная ёмкость агента")
+	}
+	log.Printf("Агент %s подключён по gRPC, ёмкость %d", req.GetAgentId(), capacity)
+
+	stream := t.s.openStream(req.GetAgentId(), capacity, req.GetOperations())
+	t.s.streamTasks(srv.Context(), stream, func(task *models.Task) error {
+		return srv.Send(taskpb.FromTask(task))
+	})
+	requeued := t.s.closeStream(stream)
+	log.Printf("gRPC-агент отключён, возвращено задач в очередь: %d", requeued)
+	return srv.Context().Err()
+}
+
+// SubmitResults принимает результаты агента, идентификатор которого
+// передаётся в метаданных вызова под именем models.AgentIDHeader.
+func (t *taskService) SubmitResults(srv taskpb.TaskService_SubmitResultsServer) error {
+	var agentID string
+	if md, ok := metadata.FromIncomingContext(srv.Context()); ok {
+		if ids := md.Get(models.AgentIDHeader); len(ids) > 0 {
+			agentID = ids[0]
+		}
+	}
+	for {
+		msg, err := srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		code, message := t.s.applyResult(agentID, msg.ToModel())
+		if code != http.StatusOK {
+			log.Printf("Результат задачи %s по gRPC не принят: %s", msg.GetId(), message)
+		}
+		if err := srv.Send(&taskpb.ResultAck{Id: msg.GetId(), Status: int32(code), Message: message}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// progressBuffer — сколько событий может накопиться у подписчика. Подписчик,
+// не успевающий их читать, отключается, чтобы не задерживать обработку
+// результатов; клиент может переподключиться.
+const progressBuffer = 256
+
+// sseKeepAlive — как часто в пустой поток отправляется комментарий, чтобы
+// промежуточные прокси не закрывали соединение.
+const sseKeepAlive = 15 * time.Second
+
+// progressHub рассылает события хода вычисления подписчикам.
+type progressHub struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*progressSub]struct{}
+}
+
+// progressSub — подписка на события одного выражения или всех (exprID
+// пустой). Если задан eventType, передаются только события этого типа.
+type progressSub struct {
+	exprID    string
+	eventType string
+	events    chan models.ProgressEvent
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subs: make(map[*progressSub]struct{})}
+}
+
+func (h *progressHub) subscribe(exprID, eventType string) *progressSub {
+	sub := &progressSub{exprID: exprID, eventType: eventType, events: make(chan models.ProgressEvent, progressBuffer)}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *progressHub) unsubscribe(sub *progressSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// publish отправляет событие подписчикам, не блокируясь.
+func (h *progressHub) publish(ev models.ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.ID = h.seq
+	ev.Time = time.Now()
+	for sub := range h.subs {
+		if (sub.exprID != "" && sub.exprID != ev.ExpressionID) || (sub.eventType != "" && sub.eventType != ev.Type) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			log.Printf("Подписчик на события выражения %q не успевает их читать и отключён", sub.exprID)
+			delete(h.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// notifyNode сообщает подписчикам о вычисленной операции. Вызывается под s.Mutex.
+func (s *Server) notifyNode(expr *models.Expression, nodeID string, value float64) {
+	copied := *expr
+	s.progress.publish(models.ProgressEvent{
+		Type: models.ProgressNodeCompleted, ExpressionID: expr.ID,
+		NodeID: nodeID, Value: &value, Expression: &copied,
+	})
+}
+
+// notifyStatus сообщает подписчикам о новом статусе выражения, а для
+// завершающего статуса — и об итоге вычисления. Вызывается под s.Mutex
+// после того, как все поля выражения обновлены.
+func (s *Server) notifyStatus(expr *models.Expression) {
+	copied := *expr
+	s.progress.publish(models.ProgressEvent{Type: models.ProgressStatusChanged, ExpressionID: expr.ID, Expression: &copied})
+	if expr.Status.IsTerminal() {
+		s.progress.publish(models.ProgressEvent{Type: models.ProgressResult, ExpressionID: expr.ID, Expression: &copied})
+	}
+}
+
+// wantsEventStream сообщает, что клиент запросил поток Server-Sent Events.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// handleProgressStream передаёт события хода вычисления всех выражений.
+func (s *Server) handleProgressStream(w http.ResponseWriter, r *http.Request) {
+	s.serveProgress(w, r, "")
+}
+
+// serveProgress передаёт клиенту события хода вычисления выражения exprID
+// (пустой — всех выражений) в формате Server-Sent Events. Поток выражения
+// начинается с его текущего состояния и завершается после события result.
+func (s *Server) serveProgress(w http.ResponseWriter, r *http.Request, exprID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Потоковая передача не поддерживается", http.StatusInternalServerError)
+		return
+	}
+	// Подписка оформляется до чтения состояния, чтобы не пропустить события.
+	sub := s.progress.subscribe(exprID, "")
+	defer s.progress.unsubscribe(sub)
+
+	var initial []models.ProgressEvent
+	if exprID != "" {
+		s.Mutex.Lock()
+		expr, ok := s.Expressions[exprID]
+		if ok {
+			copied := *expr
+			initial = append(initial, models.ProgressEvent{Type: models.ProgressStatusChanged, ExpressionID: exprID, Expression: &copied})
+			if expr.Status.IsTerminal() {
+				initial = append(initial, models.ProgressEvent{Type: models.ProgressResult, ExpressionID: exprID, Expression: &copied})
+			}
+		}
+		s.Mutex.Unlock()
+		if !ok {
+			http.Error(w, "Выражение не найдено", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev models.ProgressEvent) bool {
+		data, _ := json.Marshal(ev)
+		if ev.ID > 0 {
+			fmt.Fprintf(w, "id: %d\n", ev.ID)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return !(exprID != "" && ev.Type == models.ProgressResult)
+	}
+	for _, ev := range initial {
+		if !send(ev) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok || !send(ev) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package orchestrator
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// Scheduler определяет политику выбора следующей задачи для агента.
+// Реализации не потокобезопасны: доступ защищается Server.QueueMutex.
+type Scheduler interface {
+	// Push добавляет задачу в очередь.
+	Push(task *models.Task)
+	// Pop извлекает следующую задачу или возвращает nil, если очередь пуста.
+	Pop() *models.Task
+	// PopMatching извлекает следующую задачу, для которой accept возвращает
+	// true, или nil, если таких задач нет. Порядок остальных задач не меняется.
+	PopMatching(accept func(*models.Task) bool) *models.Task
+	// Len возвращает количество задач в очереди.
+	Len() int
+	// Remove удаляет из очереди все задачи, для которых match возвращает true,
+	// и возвращает их количество.
+	Remove(match func(*models.Task) bool) int
+	// Tasks возвращает задачи очереди в порядке поступления, не меняя очередь.
+	Tasks() []*models.Task
+}
+
+// Политики планирования, выбираемые переменной окружения SCHEDULING_POLICY.
+const (
+	PolicyPriority = "priority"
+	PolicyFair     = "fair"
+	PolicyAging    = "aging"
+	PolicyDeadline = "edf"
+)
+
+// expressionPriorityScale — вес приоритета выражения относительно приоритета
+// узла: задача выражения с большим клиентским приоритетом всегда опережает
+// задачи менее приоритетных выражений, а внутри одного уровня порядок
+// определяется приоритетом узла.
+const expressionPriorityScale = 1_000_000
+
+// maxExpressionPriority ограничивает приоритет выражения по модулю, чтобы
+// взвешенный приоритет задачи не переполнялся и не менял порядок на обратный.
+const maxExpressionPriority = 1_000_000
+
+// effectivePriority объединяет приоритет выражения и приоритет узла.
+func effectivePriority(task *models.Task) int64 {
+	return int64(task.ExpressionPriority)*expressionPriorityScale + int64(task.Priority)
+}
+
+// defaultAgingRate — прирост приоритета задачи за каждую миллисекунду ожидания.
+const defaultAgingRate = 1.0
+
+// NewScheduler создаёт планировщик с заданной политикой.
+func NewScheduler(policy string) (Scheduler, error) {
+	switch policy {
+	case "", PolicyPriority:
+		return NewPriorityScheduler(), nil
+	case PolicyFair:
+		return NewFairScheduler(), nil
+	case PolicyAging:
+		return NewAgingScheduler(defaultAgingRate, time.Now), nil
+	case PolicyDeadline:
+		return NewDeadlineScheduler(), nil
+	default:
+		return nil, fmt.Errorf("неизвестная политика планирования: %s", policy)
+	}
+}
+
+// NewSchedulerFromEnv создаёт планировщик по переменным окружения
+// SCHEDULING_POLICY и SCHEDULING_AGING_RATE.
+func NewSchedulerFromEnv() Scheduler {
+	policy := os.Getenv("SCHEDULING_POLICY")
+	if policy == PolicyAging {
+		rate := defaultAgingRate
+		if valStr := os.Getenv("SCHEDULING_AGING_RATE"); valStr != "" {
+			val, err := strconv.ParseFloat(valStr, 64)
+			if err != nil || val <= 0 {
+				log.Printf("Ошибка преобразования SCHEDULING_AGING_RATE: %q", valStr)
+			} else {
+				rate = val
+			}
+		}
+		return NewAgingScheduler(rate, time.Now)
+	}
+	scheduler, err := NewScheduler(policy)
+	if err != nil {
+		log.Printf("%v, используется %s", err, PolicyPriority)
+		return NewPriorityScheduler()
+	}
+	return scheduler
+}
+
+// queuedTask — задача в очереди вместе с порядковым номером постановки,
+// который обеспечивает FIFO-порядок при равных ключах.
+type queuedTask struct {
+	task *models.Task
+	seq  uint64
+	key  float64
+}
+
+// TaskPriorityQueue — двоичная куча задач с настраиваемым порядком.
+type TaskPriorityQueue struct {
+	items []*queuedTask
+	less  func(a, b *queuedTask) bool
+}
+
+func (pq TaskPriorityQueue) Len() int {
+	return len(pq.items)
+}
+
+func (pq TaskPriorityQueue) Less(i, j int) bool {
+	return pq.less(pq.items[i], pq.items[j])
+}
+
+func (pq TaskPriorityQueue) Swap(i, j int) {
+	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+}
+
+func (pq *TaskPriorityQueue) Push(x interface{}) {
+	pq.items = append(pq.items, x.(*queuedTask))
+}
+
+func (pq *TaskPriorityQueue) Pop() interface{} {
+	old := pq.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	pq.items = old[0 : n-1]
+
+	return item
+}
+
+// findMatching возвращает индекс первой в порядке кучи задачи, для которой
+// accept возвращает true, или -1, если таких задач нет.
+func (pq *TaskPriorityQueue) findMatching(accept func(*models.Task) bool) int {
+	best := -1
+	for i, item := range pq.items {
+		if (best < 0 || pq.less(item, pq.items[best])) && accept(item.task) {
+			best = i
+		}
+	}
+	return best
+}
+
+// popMatching извлекает первую в порядке кучи задачу, для которой accept
+// возвращает true. Задача ищется просмотром кучи и удаляется из неё за
+// O(log n); остальные задачи не перемещаются.
+func (pq *TaskPriorityQueue) popMatching(accept func(*models.Task) bool) *queuedTask {
+	if pq.Len() == 0 {
+		return nil
+	}
+	if accept == nil {
+		return heap.Pop(pq).(*queuedTask)
+	}
+	i := pq.findMatching(accept)
+	if i < 0 {
+		return nil
+	}
+	return heap.Remove(pq, i).(*queuedTask)
+}
+
+// removeMatching удаляет из кучи задачи, для которых match возвращает true.
+func (pq *TaskPriorityQueue) removeMatching(match func(*models.Task) bool) int {
+	kept := pq.items[:0]
+	for _, item := range pq.items {
+		if !match(item.task) {
+			kept = append(kept, item)
+		}
+	}
+	removed := len(pq.items) - len(kept)
+	for i := len(kept); i < len(pq.items); i++ {
+		pq.items[i] = nil
+	}
+	pq.items = kept
+	if removed > 0 {
+		heap.Init(pq)
+	}
+	return removed
+}
+
+// tasks возвращает задачи очереди в порядке поступления.
+func (pq *TaskPriorityQueue) tasks() []*models.Task {
+	items := append([]*queuedTask(nil), pq.items...)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+	tasks := make([]*models.Task, len(items))
+	for i, item := range items {
+		tasks[i] = item.task
+	}
+	return tasks
+}
+
+// byPriority упорядочивает задачи по убыванию приоритета, а при равенстве — по времени постановки.
+func byPriority(a, b *queuedTask) bool {
+	pa, pb := effectivePriority(a.task), effectivePriority(b.task)
+	if pa != pb {
+		return pa > pb
+	}
+	return a.seq < b.seq
+}
+
+// byDeadline упорядочивает задачи по возрастанию срока (задачи без срока —
+// в конце), а при равенстве — по приоритету.
+func byDeadline(a, b *queuedTask) bool {
+	da, db := a.task.Deadline, b.task.Deadline
+	switch {
+	case da != nil && db != nil && !da.Equal(*db):
+		return da.Before(*db)
+	case da != nil && db == nil:
+		return true
+	case da == nil && db != nil:
+		return false
+	}
+	return byPriority(a, b)
+}
+
+// byKey упорядочивает задачи по возрастанию ключа, а при равенстве — по времени постановки.
+func byKey(a, b *queuedTask) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.seq < b.seq
+}
+
+// PriorityScheduler выдаёт задачу с наибольшим приоритетом, при равных
+// приоритетах — в порядке поступления.
+type PriorityScheduler struct {
+	queue TaskPriorityQueue
+	seq   uint64
+}
+
+// NewPriorityScheduler создаёт планировщик со строгими приоритетами.
+func NewPriorityScheduler() *PriorityScheduler {
+	return &PriorityScheduler{queue: TaskPriorityQueue{less: byPriority}}
+}
+
+func (s *PriorityScheduler) Push(task *models.Task) {
+	s.seq++
+	heap.Push(&s.queue, &queuedTask{task: task, seq: s.seq})
+}
+
+func (s *PriorityScheduler) Pop() *models.Task {
+	return s.PopMatching(nil)
+}
+
+func (s *PriorityScheduler) PopMatching(accept func(*models.Task) bool) *models.Task {
+	if item := s.queue.popMatching(accept); item != nil {
+		return item.task
+	}
+	return nil
+}
+
+func (s *PriorityScheduler) Len() int {
+	return s.queue.Len()
+}
+
+func (s *PriorityScheduler) Remove(match func(*models.Task) bool) int {
+	return s.queue.removeMatching(match)
+}
+
+func (s *PriorityScheduler) Tasks() []*models.Task {
+	return s.queue.tasks()
+}
+
+// NewDeadlineScheduler создаёт планировщик «ближайший срок — первым» (EDF):
+// задачи выражений с более ранним сроком выдаются раньше, задачи без срока —
+// после них в порядке приоритета.
+func NewDeadlineScheduler() *PriorityScheduler {
+	return &PriorityScheduler{queue: TaskPriorityQueue{less: byDeadline}}
+}
+
+// AgingScheduler повышает приоритет задачи пропорционально времени ожидания:
+// эффективный приоритет равен Priority + rate*ожидание_в_мс. Поскольку все
+// задачи стареют с одной скоростью, порядок между ними не меняется со
+// временем и задаётся ключом rate*момент_постановки - Priority. Задача с
+// приоритетом p ждёт не дольше (pmax-p)/rate мс плюс время разбора очереди,
+// накопленной к моменту её постановки.
+type AgingScheduler struct {
+	queue TaskPriorityQueue
+	seq   uint64
+	rate  float64
+	start time.Time
+	now   func() time.Time
+}
+
+// NewAgingScheduler создаёт планировщик со старением приоритетов.
+// rate — прирост приоритета за миллисекунду ожидания, now — источник времени.
+func NewAgingScheduler(rate float64, now func() time.Time) *AgingScheduler {
+	return &AgingScheduler{
+		queue: TaskPriorityQueue{less: byKey},
+		rate:  rate,
+		start: now(),
+		now:   now,
+	}
+}
+
+func (s *AgingScheduler) Push(task *models.Task) {
+	s.seq++
+	enqueuedMs := float64(s.now().Sub(s.start)) / float64(time.Millisecond)
+	heap.Push(&s.queue, &queuedTask{
+		task: task,
+		seq:  s.seq,
+		key:  s.rate*enqueuedMs - float64(effectivePriority(task)),
+	})
+}
+
+func (s *AgingScheduler) Pop() *models.Task {
+	return s.PopMatching(nil)
+}
+
+func (s *AgingScheduler) PopMatching(accept func(*models.Task) bool) *models.Task {
+	if item := s.queue.popMatching(accept); item != nil {
+		return item.task
+	}
+	return nil
+}
+
+func (s *AgingScheduler) Len() int {
+	return s.queue.Len()
+}
+
+func (s *AgingScheduler) Remove(match func(*models.Task) bool) int {
+	return s.queue.removeMatching(match)
+}
+
+func (s *AgingScheduler) Tasks() []*models.Task {
+	return s.queue.tasks()
+}
+
+// fairFlow — очередь задач одного выражения.
+type fairFlow struct {
+	id     string
+	queue  TaskPriorityQueue
+	finish float64
+}
+
+// FairScheduler реализует взвешенное справедливое планирование (WFQ) между
+// выражениями: каждое выражение образует отдельный поток, внутри потока
+// задачи упорядочены по приоритету, а между потоками выбирается поток с
+// наименьшей виртуальной меткой завершения. Стоимость задачи равна её
+// OperationTime, делённому на вес потока (1 + приоритет выражения), поэтому
+// ни одно выражение не может надолго занять агентов: задача ждёт не дольше,
+// чем обслуживаются несколько задач каждого из остальных активных потоков.
+type FairScheduler struct {
+	flows   map[string]*fairFlow
+	active  TaskPriorityQueue
+	seq     uint64
+	virtual float64
+	size    int
+}
+
+// NewFairScheduler создаёт планировщик со справедливым разделением между выражениями.
+func NewFairScheduler() *FairScheduler {
+	return &FairScheduler{
+		flows:  make(map[string]*fairFlow),
+		active: TaskPriorityQueue{less: byKey},
+	}
+}
+
+func (s *FairScheduler) Push(task *models.Task) {
+	s.seq++
+	flow, ok := s.flows[task.ExpressionID]
+	if !ok {
+		flow = &fairFlow{id: task.ExpressionID, queue: TaskPriorityQueue{less: byPriority}}
+		s.flows[task.ExpressionID] = flow
+	}
+	heap.Push(&flow.queue, &queuedTask{task: task, seq: s.seq})
+	s.size++
+	if flow.queue.Len() == 1 {
+		s.activate(flow)
+	}
+}
+
+func (s *FairScheduler) Pop() *models.Task {
+	return s.PopMatching(nil)
+}
+
+// PopMatching выдаёт первую подходящую задачу того потока с наименьшей
+// меткой завершения, в котором такая задача есть.
+func (s *FairScheduler) PopMatching(accept func(*models.Task) bool) *models.Task {
+	best := -1
+	for i, head := range s.active.items {
+		if best >= 0 && !s.active.less(head, s.active.items[best]) {
+			continue
+		}
+		if accept == nil || s.flows[head.task.ExpressionID].queue.findMatching(accept) >= 0 {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	head := heap.Remove(&s.active, best).(*queuedTask)
+	flow := s.flows[head.task.ExpressionID]
+	item := flow.queue.popMatching(accept)
+	s.size--
+	s.virtual = head.key
+	flow.finish = head.key
+	if flow.queue.Len() > 0 {
+		s.activate(flow)
+	} else {
+		delete(s.flows, flow.id)
+	}
+	return item.task
+}
+
+func (s *FairScheduler) Len() int {
+	return s.size
+}
+
+func (s *FairScheduler) Remove(match func(*models.Task) bool) int {
+	total := 0
+	for id, flow := range s.flows {
+		removed := flow.queue.removeMatching(match)
+		if removed == 0 {
+			continue
+		}
+		total += removed
+		s.size -= removed
+		s.active.removeMatching(func(task *models.Task) bool {
+			return task.ExpressionID == id
+		})
+		if flow.queue.Len() > 0 {
+			s.activate(flow)
+		} else {
+			delete(s.flows, id)
+		}
+	}
+	return total
+}
+
+func (s *FairScheduler) Tasks() []*models.Task {
+	all := TaskPriorityQueue{}
+	for _, flow := range s.flows {
+		all.items = append(all.items, flow.queue.items...)
+	}
+	return all.tasks()
+}
+
+// activate ставит поток в очередь активных с меткой завершения его головной задачи.
+func (s *FairScheduler) activate(flow *fairFlow) {
+	head := flow.queue.items[0]
+	start := flow.finish
+	if s.virtual > start {
+		start = s.virtual
+	}
+	cost := float64(head.task.OperationTime)
+	if cost < 1 {
+		cost = 1
+	}
+	if head.task.ExpressionPriority > 0 {
+		cost /= float64(1 + head.task.ExpressionPriority)
+	}
+	heap.Push(&s.active, &queuedTask{task: head.task, seq: head.seq, key: start + cost})
+}
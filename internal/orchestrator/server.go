@@ -1,116 +1,385 @@
 package orchestrator
 
 import (
-	"container/heap"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Diverstt/Calculator_Yandex/internal/models"
 	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+	"github.com/Diverstt/Calculator_Yandex/internal/storage"
 )
 
-type TaskPriorityQueue []*models.Task
-
-func (pq TaskPriorityQueue) Len() int {
-	return len(pq)
-}
-
-func (pq TaskPriorityQueue) Less(i, j int) bool {
-	return pq[i].Priority > pq[j].Priority
-}
-
-func (pq TaskPriorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-}
-
-func (pq *TaskPriorityQueue) Push(x interface{}) {
-	*pq = append(*pq, x.(*models.Task))
-}
-func (pq *TaskPriorityQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	*pq = old[0 : n-1]
-
-	return item
-}
-
 type Server struct {
 	Router      *http.ServeMux
 	Expressions map[string]*models.Expression
 	ASTs        map[string]*parser.Node
-	TaskQueue   TaskPriorityQueue
+	TaskQueue   Scheduler
 	QueueMutex  sync.Mutex
 	Mutex       sync.Mutex
+
+	// index — копии выражений для выборки списка без блокировки Mutex.
+	// Обновляется после каждого изменения выражения.
+	index *storage.ExpressionIndex
+	// progress рассылает события хода вычисления клиентам (SSE).
+	progress *progressHub
+
+	// MaxEvaluationTime ограничивает время вычисления любого выражения (0 — без ограничения).
+	MaxEvaluationTime time.Duration
+
+	// taskReady закрывается и пересоздаётся при каждой постановке задачи в
+	// очередь, пробуждая агентов, ожидающих задачу. Защищён QueueMutex.
+	taskReady chan struct{}
+
+	// streams — открытые потоковые соединения агентов (WebSocket и gRPC).
+	streams      map[*taskStream]struct{}
+	streamsMutex sync.Mutex
+
+	Agents      map[string]*models.Agent
+	AgentsMutex sync.Mutex
+	// HeartbeatTimeout — через сколько после последнего пульса агент
+	// считается недоступным, а его задачи возвращаются в очередь.
+	HeartbeatTimeout time.Duration
+	// dispatched — выданные агентам задачи без результата. Защищён AgentsMutex.
+	dispatched map[string]*dispatch
+	// revoked — агенты, у которых задача была отозвана и возвращена в
+	// очередь, по ID задачи: их запоздавший результат всё ещё принимается.
+	// Защищён AgentsMutex.
+	revoked map[string][]string
+
+	// Events — журнал изменений состояния выражений.
+	Events *EventLog
+	// Store — надёжное хранилище выражений (см. OpenStore); nil, если
+	// выражения хранятся только в памяти.
+	Store *storage.MemoryStore
+	// storeWriter сохраняет изменения выражений в Store в фоне.
+	storeWriter *storeWriter
+
+	// closing закрывается при остановке сервера (см. BeginShutdown).
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// acks — подтверждения уже обработанных результатов по ID задачи,
+	// которые возвращаются при повторной доставке; ackOrder — их ID в
+	// порядке сохранения. Защищены Mutex.
+	acks     map[string]models.ResultAck
+	ackOrder []string
+	// MaxResultAcks — сколько последних подтверждений хранить для повторных
+	// доставок (MAX_RESULT_ACKS); 0 — без ограничения.
+	MaxResultAcks int
+	// batches — ID выражений каждого пакета в порядке приёма. Защищён Mutex.
+	batches map[string][]string
+	// exprIDs и batchIDs выдают ID выражений и пакетов. Защищены Mutex.
+	exprIDs  idSequence
+	batchIDs idSequence
+
+	// FusionMaxNodes — сколько операций поддерева можно передать агенту одной
+	// задачей (FUSION_MAX_NODES); значение 1 и меньше отключает объединение.
+	FusionMaxNodes int
+	// FusionMaxTime ограничивает суммарное время операций объединённого
+	// поддерева в мс (FUSION_MAX_TIME_MS); 0 — без ограничения.
+	FusionMaxTime int
+
+	// WebhookSecret — ключ подписи уведомлений о завершении (WEBHOOK_SECRET);
+	// пока он не задан, callback_url не принимается.
+	WebhookSecret string
+	// WebhookAllowedNets — внутренние сети, в которые всё же можно отправлять
+	// уведомления (WEBHOOK_ALLOWED_NETS, список CIDR через запятую).
+	WebhookAllowedNets []*net.IPNet
+	// WebhookMaxAttempts — сколько раз пытаться доставить уведомление
+	// (WEBHOOK_MAX_ATTEMPTS), WebhookRetryBase и WebhookRetryMax — начальная
+	// и наибольшая задержка между попытками (WEBHOOK_RETRY_BASE, WEBHOOK_RETRY_MAX).
+	WebhookMaxAttempts int
+	WebhookRetryBase   time.Duration
+	WebhookRetryMax    time.Duration
+	webhookClient      *http.Client
 }
 
 func NewServer() *Server {
 	s := &Server{
-		Router:      http.NewServeMux(),
-		Expressions: make(map[string]*models.Expression),
-		ASTs:        make(map[string]*parser.Node),
-		TaskQueue:   make(TaskPriorityQueue, 0),
+		Router:            http.NewServeMux(),
+		Expressions:       make(map[string]*models.Expression),
+		ASTs:              make(map[string]*parser.Node),
+		index:             storage.NewExpressionIndex(),
+		progress:          newProgressHub(),
+		TaskQueue:         NewSchedulerFromEnv(),
+		MaxEvaluationTime: durationFromEnv("MAX_EVALUATION_TIME", 0),
+		taskReady:         make(chan struct{}),
+		streams:           make(map[*taskStream]struct{}),
+		Agents:            make(map[string]*models.Agent),
+		HeartbeatTimeout:  durationFromEnv("AGENT_HEARTBEAT_TIMEOUT", 15*time.Second),
+		dispatched:        make(map[string]*dispatch),
+		revoked:           make(map[string][]string),
+		acks:              make(map[string]models.ResultAck),
+		MaxResultAcks:     intFromEnv("MAX_RESULT_ACKS", 100000),
+		batches:           make(map[string][]string),
+		closing:           make(chan struct{}),
+		Events:            NewEventLog(),
+		FusionMaxNodes:    intFromEnv("FUSION_MAX_NODES", 1),
+		FusionMaxTime:     intFromEnv("FUSION_MAX_TIME_MS", 0),
+
+		WebhookSecret:      os.Getenv("WEBHOOK_SECRET"),
+		WebhookMaxAttempts: intFromEnv("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryBase:   durationFromEnv("WEBHOOK_RETRY_BASE", time.Second),
+		WebhookRetryMax:    durationFromEnv("WEBHOOK_RETRY_MAX", time.Minute),
+		WebhookAllowedNets: netsFromEnv("WEBHOOK_ALLOWED_NETS"),
 	}
-	heap.Init(&s.TaskQueue)
+	s.webhookClient = s.newWebhookClient(durationFromEnv("WEBHOOK_TIMEOUT", 10*time.Second))
 	s.Router.HandleFunc("/api/v1/calculate", s.handleCalculate)
+	s.Router.HandleFunc("/api/v1/calculate/batch", s.handleCalculateBatch)
+	s.Router.HandleFunc("/api/v1/batches/", s.handleBatch)
 	s.Router.HandleFunc("/api/v1/expressions", s.handleExpressions)
 	s.Router.HandleFunc("/api/v1/expressions/", s.handleExpressionByID)
+	s.Router.HandleFunc("/api/v1/events", s.handleProgressStream)
+	s.Router.HandleFunc("/api/v1/export", s.handleExport)
+	s.Router.HandleFunc("/api/v1/import", s.handleImport)
 	s.Router.HandleFunc("/internal/task", s.handleTask)
 	s.Router.HandleFunc("/internal/task/result", s.handleTaskResult)
+	s.Router.HandleFunc("/internal/task/results", s.handleTaskResults)
+	s.Router.HandleFunc("/internal/task/stream", s.handleTaskStream)
+	s.Router.HandleFunc("/internal/agents", s.handleAgents)
+	s.Router.HandleFunc("/internal/agents/register", s.handleAgentRegister)
+	s.Router.HandleFunc("/internal/agents/heartbeat", s.handleAgentHeartbeat)
+	s.Router.HandleFunc("/internal/agents/deregister", s.handleAgentDeregister)
+	s.Router.HandleFunc("/api/v1/admin/agents", s.handleAgents)
 
 	return s
 }
 
+// calculateRequest — параметры вычисления одного выражения.
+type calculateRequest struct {
+	Expression  string             `json:"expression"`
+	Variables   map[string]float64 `json:"variables"`
+	Priority    int                `json:"priority"`
+	Deadline    *time.Time         `json:"deadline"`
+	Timeout     string             `json:"timeout"`
+	CallbackURL string             `json:"callback_url"`
+}
+
 func (s *Server) handleCalculate(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Expression string `json:"expression"`
+	if s.shuttingDown() {
+		http.Error(w, "Сервер останавливается", http.StatusServiceUnavailable)
+		return
 	}
-
+	wait, ok := parseSyncWait(r)
+	if !ok {
+		http.Error(w, "Неверное время ожидания результата", http.StatusBadRequest)
+		return
+	}
+	var input calculateRequest
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Неверный формат запроса", http.StatusUnprocessableEntity)
 		return
 	}
+	expr, ast, err := s.prepareExpression(input, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
-	exprID := time.Now().Format("20060102150405")
-	expr := &models.Expression{ID: exprID, Status: "pending"}
+	s.Mutex.Lock()
+	exprID := s.addExpression(expr, ast)
+	s.Mutex.Unlock()
 
-	ast, err := parser.ParseExpression(input.Expression)
-	if err != nil {
-		http.Error(w, "Неверное арифметическое выражение", http.StatusUnprocessableEntity)
+	if wait > 0 {
+		s.awaitResult(w, r, exprID, wait)
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"id": exprID})
+}
 
-	parser.AssignIDs(exprID, ast)
+// prepareExpression проверяет запрос на вычисление и строит выражение и
+// его дерево, ещё не регистрируя их. Текст ошибки предназначен клиенту.
+func (s *Server) prepareExpression(input calculateRequest, now time.Time) (*models.Expression, *parser.Node, error) {
+	if input.Deadline != nil && !input.Deadline.After(now) {
+		return nil, nil, errors.New("Срок вычисления уже истёк")
+	}
+	if input.Priority < -maxExpressionPriority || input.Priority > maxExpressionPriority {
+		return nil, nil, fmt.Errorf("Приоритет должен быть от %d до %d", -maxExpressionPriority, maxExpressionPriority)
+	}
+	timeout := s.MaxEvaluationTime
+	if input.Timeout != "" {
+		requested, err := time.ParseDuration(input.Timeout)
+		if err != nil || requested <= 0 {
+			return nil, nil, errors.New("Неверное время ожидания")
+		}
+		if timeout == 0 || requested < timeout {
+			timeout = requested
+		}
+	}
+	var timeoutAt *time.Time
+	if timeout > 0 {
+		limit := now.Add(timeout)
+		timeoutAt = &limit
+	}
 
-	s.Mutex.Lock()
+	if input.CallbackURL != "" {
+		if err := s.validateCallbackURL(input.CallbackURL); err != nil {
+			return nil, nil, fmt.Errorf("Неверный адрес уведомления: %v", err)
+		}
+	}
+
+	ast, err := parser.ParseExpressionWithVars(input.Expression, input.Variables)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Неверное арифметическое выражение: %v", err)
+	}
+	expr := &models.Expression{
+		Text:      input.Expression,
+		Status:    models.StatusPending,
+		Priority:  input.Priority,
+		Deadline:  input.Deadline,
+		CreatedAt: now,
+		TimeoutAt: timeoutAt,
+
+		CallbackURL: input.CallbackURL,
+		Variables:   input.Variables,
+	}
+	return expr, ast, nil
+}
+
+// addExpression присваивает выражению ID, регистрирует его и ставит в
+// очередь готовые задачи. Вызывается под s.Mutex.
+func (s *Server) addExpression(expr *models.Expression, ast *parser.Node) string {
+	exprID := s.newExpressionID()
+	expr.ID = exprID
+	parser.AssignIDs(exprID, ast)
+	expr.TotalNodes, _ = parser.CountOperations(ast)
 	s.Expressions[exprID] = expr
 	s.ASTs[exprID] = ast
-	s.Mutex.Unlock()
+	s.indexExpression(expr)
+	s.addToBatch(expr)
 
-	log.Printf("Выражение %s принято: %s", exprID, input.Expression)
+	log.Printf("Выражение %s принято: %s", exprID, expr.Text)
+	submitted := *expr
+	s.record(models.Event{Type: models.EventSubmitted, ExpressionID: exprID, Text: expr.Text, Expression: &submitted})
 
-	s.scheduleReadyTasks(exprID, ast)
+	s.startEvaluation(expr, ast)
+	return exprID
+}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": exprID})
+// startEvaluation ставит в очередь готовые задачи выражения. Выражение без
+// операций (число или одна переменная) вычислено уже при разборе и сразу
+// завершается. Вызывается под s.Mutex.
+func (s *Server) startEvaluation(expr *models.Expression, ast *parser.Node) {
+	if !ast.Computed {
+		s.scheduleReadyTasks(expr, ast)
+		return
+	}
+	if !s.transition(expr, models.StatusInProgress) || !s.transition(expr, models.StatusCompleted) {
+		return
+	}
+	now := time.Now()
+	value := ast.Value
+	expr.Result = &value
+	expr.StartedAt, expr.FinishedAt = &now, &now
+	log.Printf("Выражение %s не содержит операций, результат: %f", expr.ID, value)
+	s.indexExpression(expr)
+	s.recordExpression(models.EventCompleted, expr)
+	s.notifyStatus(expr)
+	s.startWebhook(expr)
+}
+
+// newExpressionID возвращает уникальный идентификатор выражения на основе
+// текущего времени. Вызывается под s.Mutex.
+func (s *Server) newExpressionID() string {
+	return s.exprIDs.next(time.Now().Format("20060102150405"), func(id string) bool {
+		_, exists := s.Expressions[id]
+		return exists
+	})
+}
+
+// idSequence выдаёт ID вида <метка> и <метка>.N для последовательных
+// запросов с одной меткой времени. Номер берётся из счётчика, поэтому
+// поиск свободного ID не растёт с числом ID за ту же секунду; проверка
+// taken нужна лишь для ID, загруженных из снимка, журнала или выгрузки.
+type idSequence struct {
+	stamp string
+	n     int
 }
 
+func (q *idSequence) next(stamp string, taken func(id string) bool) string {
+	if stamp != q.stamp {
+		q.stamp, q.n = stamp, 0
+	}
+	for {
+		q.n++
+		id := stamp
+		if q.n > 1 {
+			id = fmt.Sprintf("%s.%d", stamp, q.n)
+		}
+		if !taken(id) {
+			return id
+		}
+	}
+}
+
+// maxListLimit ограничивает размер страницы списка выражений.
+const maxListLimit = 1000
+
+// handleExpressions возвращает список выражений. Параметры: status —
+// фильтр по статусу, since — время создания не раньше (RFC 3339), sort —
+// поле сортировки ("-" в начале — по убыванию, по умолчанию created_at),
+// limit — размер страницы (без него возвращаются все выражения), cursor —
+// next_cursor предыдущей страницы.
 func (s *Server) handleExpressions(w http.ResponseWriter, r *http.Request) {
-	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
-	expressions := make([]models.Expression, 0, len(s.Expressions))
-	for _, expr := range s.Expressions {
-		expressions = append(expressions, *expr)
+	query := r.URL.Query()
+	q := storage.ListQuery{
+		Status: models.ExpressionStatus(query.Get("status")),
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+	}
+	if q.Status != "" && !q.Status.Valid() {
+		http.Error(w, "Неизвестный статус", http.StatusBadRequest)
+		return
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			http.Error(w, "Неверное время since", http.StatusBadRequest)
+			return
+		}
+		q.Since = t
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{"expressions": expressions})
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Неверный размер страницы", http.StatusBadRequest)
+			return
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+		q.Limit = limit
+	}
+
+	page, err := s.index.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := map[string]interface{}{"expressions": page.Expressions, "total": page.Total}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	json.NewEncoder(w).Encode(response)
 }
 
 func (s *Server) handleExpressionByID(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/v1/expressions/")
+	if exprID := strings.TrimSuffix(id, "/events"); exprID != id {
+		s.handleExpressionEvents(w, r, exprID)
+		return
+	}
 	s.Mutex.Lock()
 	defer s.Mutex.Unlock()
 	expr, ok := s.Expressions[id]
@@ -121,18 +390,184 @@ func (s *Server) handleExpressionByID(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"expression": expr})
 }
 
+// maxTaskWait ограничивает время, на которое агент может удерживать запрос задачи.
+const maxTaskWait = time.Minute
+
+// maxTaskBatch ограничивает количество задач, выдаваемых агенту за один запрос.
+const maxTaskBatch = 100
+
 func (s *Server) handleTask(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var wait time.Duration
+	if waitStr := query.Get("wait"); waitStr != "" {
+		var err error
+		wait, err = time.ParseDuration(waitStr)
+		if err != nil || wait < 0 {
+			http.Error(w, "Неверное время ожидания", http.StatusBadRequest)
+			return
+		}
+		if wait > maxTaskWait {
+			wait = maxTaskWait
+		}
+	}
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Неверное количество задач", http.StatusBadRequest)
+			return
+		}
+		if limit > maxTaskBatch {
+			limit = maxTaskBatch
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	agentID := r.Header.Get(models.AgentIDHeader)
+	accept := s.taskFilter(agentID, parseOperations(query.Get("ops")))
+	task := s.waitTask(ctx, accept)
+	if task == nil && s.shuttingDown() {
+		http.Error(w, "Сервер останавливается", http.StatusServiceUnavailable)
+		return
+	}
+	if task == nil {
+		http.Error(w, "Нет доступных задач", http.StatusNotFound)
+		return
+	}
+	s.markDispatched(task, agentID)
+	log.Printf("Задача %s отправлена агенту: %+v", task.ID, task)
+	if limit == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"task": task})
+		return
+	}
+
+	// Пакетный запрос: к первой задаче добавляются уже готовые, без ожидания.
+	tasks := []*models.Task{task}
+	for len(tasks) < limit {
+		task := s.nextTask(accept)
+		if task == nil {
+			break
+		}
+		s.markDispatched(task, agentID)
+		tasks = append(tasks, task)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks})
+}
+
+// waitTask возвращает следующую задачу, подходящую под accept (nil — любую),
+// при отсутствии таких задач ожидая их появления до отмены ctx. После
+// BeginShutdown задачи не выдаются.
+func (s *Server) waitTask(ctx context.Context, accept func(*models.Task) bool) *models.Task {
+	for {
+		if s.shuttingDown() {
+			return nil
+		}
+		// Канал берётся до проверки очереди, чтобы не пропустить задачу,
+		// добавленную между проверкой и ожиданием.
+		s.QueueMutex.Lock()
+		ready := s.taskReady
+		s.QueueMutex.Unlock()
+
+		if task := s.nextTask(accept); task != nil {
+			return task
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil
+		case <-s.closing:
+			return nil
+		}
+	}
+}
+
+// pushTask ставит задачу в очередь и пробуждает ожидающих агентов.
+func (s *Server) pushTask(task *models.Task) {
 	s.QueueMutex.Lock()
-	if s.TaskQueue.Len() == 0 {
+	s.TaskQueue.Push(task)
+	close(s.taskReady)
+	s.taskReady = make(chan struct{})
+	s.QueueMutex.Unlock()
+}
+
+// nextTask извлекает из очереди следующую подходящую задачу, попутно
+// завершая по таймауту выражения, срок вычисления которых истёк.
+func (s *Server) nextTask(accept func(*models.Task) bool) *models.Task {
+	for {
+		s.QueueMutex.Lock()
+		task := s.TaskQueue.PopMatching(accept)
 		s.QueueMutex.Unlock()
-		http.Error(w, "Нет доступных задач", http.StatusNotFound)
+		if task == nil {
+			return nil
+		}
+		s.Mutex.Lock()
+		expr, ok := s.Expressions[task.ExpressionID]
+		overdue := ok && expr.Overdue(time.Now())
+		if overdue {
+			s.expireExpression(task.ExpressionID)
+		}
+		s.Mutex.Unlock()
+		if !overdue {
+			return task
+		}
+	}
+}
+
+// transition переводит выражение в статус to. Недопустимый переход
+// (например, из завершающего статуса) отклоняется и записывается в лог.
+// Вызывается под s.Mutex.
+func (s *Server) transition(expr *models.Expression, to models.ExpressionStatus) bool {
+	if err := expr.Transition(to); err != nil {
+		log.Printf("Ошибка смены статуса: %v", err)
+		return false
+	}
+	return true
+}
+
+// indexExpression обновляет копию выражения в индексе списка. Вызывается
+// под s.Mutex.
+func (s *Server) indexExpression(expr *models.Expression) {
+	s.index.Put(*expr)
+}
+
+// markStarted переводит выражение, задача которого выдана агенту, из
+// статуса "pending" в "in_progress". Вызывается под s.Mutex.
+func (s *Server) markStarted(exprID string, at time.Time) {
+	expr, ok := s.Expressions[exprID]
+	if !ok || expr.Status != models.StatusPending {
 		return
 	}
+	if s.transition(expr, models.StatusInProgress) {
+		expr.StartedAt = &at
+		s.indexExpression(expr)
+		s.notifyStatus(expr)
+	}
+}
 
-	task := heap.Pop(&s.TaskQueue).(*models.Task)
+// expireExpression переводит выражение в статус "timeout" и удаляет его
+// оставшиеся задачи из очереди. Вызывается под s.Mutex.
+func (s *Server) expireExpression(exprID string) {
+	expr, ok := s.Expressions[exprID]
+	if !ok || !expr.IsActive() || !s.transition(expr, models.StatusTimeout) {
+		return
+	}
+	now := time.Now()
+	expr.ErrorCode = models.ErrorCodeTimeout
+	expr.Error = "Выражение не вычислено в срок"
+	expr.FinishedAt = &now
+	s.indexExpression(expr)
+	s.notifyStatus(expr)
+	s.recordExpression(models.EventTimeout, expr)
+	s.startWebhook(expr)
+	s.forgetRevoked(exprID)
+	s.QueueMutex.Lock()
+	removed := s.TaskQueue.Remove(func(task *models.Task) bool {
+		return task.ExpressionID == exprID
+	})
 	s.QueueMutex.Unlock()
-	log.Printf("Задача %s отправлена агенту: %+v", task.ID, task)
-	json.NewEncoder(w).Encode(map[string]interface{}{"task": task})
+	log.Printf("Выражение %s не вычислено в срок, удалено задач: %d", exprID, removed)
 }
 
 func (s *Server) handleTaskResult(w http.ResponseWriter, r *http.Request) {
@@ -142,84 +577,208 @@ func (s *Server) handleTaskResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Если пришла ошибка вычисления (например, деление на ноль)
-	if res.Error != "" {
-		s.Mutex.Lock()
-		// Обновляем статус выражения на "error" для узла, связанного с данной задачей
-		for exprID, root := range s.ASTs {
-			node := parser.FindNodeByID(root, res.ID)
-			if node != nil {
-				if expr, ok := s.Expressions[exprID]; ok {
-					expr.Status = "error"
-				}
-				break
-			}
-		}
-		s.Mutex.Unlock()
-		http.Error(w, res.Error, http.StatusUnprocessableEntity)
+	status, message := s.applyResult(r.Header.Get(models.AgentIDHeader), res)
+	if status != http.StatusOK {
+		http.Error(w, message, status)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]string{"status": message})
+}
 
+// handleTaskResults принимает пакет результатов и возвращает подтверждение
+// для каждого из них; ошибка в одном результате не влияет на остальные.
+func (s *Server) handleTaskResults(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Results []models.Result `json:"results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Неверный формат данных", http.StatusUnprocessableEntity)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": s.applyResults(r.Header.Get(models.AgentIDHeader), input.Results)})
+}
+
+// applyResult записывает результат задачи, присланный агентом agentID, в
+// дерево выражения и планирует ставшие готовыми узлы. Возвращает
+// HTTP-статус и текст ответа агенту.
+func (s *Server) applyResult(agentID string, res models.Result) (int, string) {
+	ack := s.applyResults(agentID, []models.Result{res})[0]
+	return ack.Status, ack.Message
+}
+
+// applyResults применяет пакет результатов агента agentID под одной
+// блокировкой s.Mutex. Место в потоке агента освобождается только для
+// принятых результатов: отклонённый результат чужой задачи не снимает её
+// с учёта потока, которому она выдана.
+func (s *Server) applyResults(agentID string, results []models.Result) []models.ResultAck {
 	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
-	found := false
-	for exprID, root := range s.ASTs {
-		node := parser.FindNodeByID(root, res.ID)
-		if node != nil {
-			node.Value = res.Result
-			node.Computed = true
-			log.Printf("Обновлен узел %s: результат %f", node.ID, res.Result)
-			if node.Parent != nil && node.Parent.IsReady() && !node.Parent.Scheduled {
-				task := &models.Task{
-					ID:            node.Parent.ID,
-					Arg1:          node.Parent.Left.Value,
-					Arg2:          node.Parent.Right.Value,
-					Operation:     node.Parent.Op,
-					OperationTime: parser.GetOperationTime(node.Parent.Op),
-					Priority:      parser.GetOperationPriority(node.Parent.Op),
-				}
-				node.Parent.Scheduled = true
-				s.QueueMutex.Lock()
-				heap.Push(&s.TaskQueue, task)
-				s.QueueMutex.Unlock()
-				log.Printf("Запланирована задача для узла %s родителя", node.Parent.ID)
-			} else if node.Parent == nil {
-				if expr, ok := s.Expressions[exprID]; ok {
-					expr.Result = &res.Result
-					expr.Status = "completed"
-					log.Printf("Выражение %s полностью вычислено: %f", exprID, res.Result)
-				}
-			}
-			found = true
-			break
+	acks := make([]models.ResultAck, len(results))
+	for i, res := range results {
+		acks[i] = s.acceptResult(agentID, res)
+	}
+	s.Mutex.Unlock()
+
+	for _, ack := range acks {
+		if ack.Status != http.StatusPreconditionFailed {
+			s.releaseStreamTask(agentID, ack.ID)
 		}
 	}
-	if !found {
-		http.Error(w, "Задача не найдена", http.StatusNotFound)
-		return
+	return acks
+}
+
+// acceptResult проверяет, что результат ожидается от агента agentID, и
+// применяет его. Повторный результат уже обработанной задачи ничего не
+// меняет и получает то же подтверждение, что и первый. Вызывается под s.Mutex.
+func (s *Server) acceptResult(agentID string, res models.Result) models.ResultAck {
+	if ack, ok := s.acks[res.ID]; ok {
+		return ack
 	}
-	json.NewEncoder(w).Encode(map[string]string{"status": "результат записан"})
+	if _, node := s.findNode(res.ID); node == nil {
+		return models.ResultAck{ID: res.ID, Status: http.StatusNotFound, Message: "Задача не найдена"}
+	}
+	if !s.completeDispatch(agentID, res) {
+		ack := models.ResultAck{ID: res.ID, Status: http.StatusPreconditionFailed, Message: "Задача не выдавалась агенту"}
+		exprID, _ := s.findNode(res.ID)
+		s.record(models.Event{Type: models.EventResultRejected, ExpressionID: exprID, TaskID: res.ID, Result: &res, Ack: &ack})
+		return ack
+	}
+	status, message := s.applyResultLocked(res)
+	ack := models.ResultAck{ID: res.ID, Status: status, Message: message}
+	s.rememberAck(ack)
+	return ack
 }
 
-func (s *Server) scheduleReadyTasks(exprID string, node *parser.Node) {
+// rememberAck сохраняет подтверждение результата для повторных доставок.
+// Хранится не больше MaxResultAcks последних подтверждений: более старые
+// вытесняются. Вызывается под s.Mutex.
+func (s *Server) rememberAck(ack models.ResultAck) {
+	if _, ok := s.acks[ack.ID]; !ok {
+		if s.MaxResultAcks > 0 && len(s.ackOrder) >= s.MaxResultAcks {
+			delete(s.acks, s.ackOrder[0])
+			s.ackOrder = s.ackOrder[1:]
+		}
+		s.ackOrder = append(s.ackOrder, ack.ID)
+	}
+	s.acks[ack.ID] = ack
+}
+
+// applyResultLocked применяет один результат. Вызывается под s.Mutex.
+func (s *Server) applyResultLocked(res models.Result) (int, string) {
+	exprID, node := s.findNode(res.ID)
 	if node == nil {
-		return
+		return http.StatusNotFound, "Задача не найдена"
+	}
+	if node.Computed {
+		// Агент повторно доставил уже записанный результат.
+		return s.recordResult(exprID, res, http.StatusOK, "результат уже записан")
+	}
+	expr := s.Expressions[exprID]
+	if expr.Overdue(time.Now()) {
+		s.expireExpression(exprID)
 	}
-	if !node.Computed && node.IsReady() && !node.Scheduled {
-		task := &models.Task{
-			ID:            node.ID,
-			Arg1:          node.Left.Value,
-			Arg2:          node.Right.Value,
-			Operation:     node.Op,
-			OperationTime: parser.GetOperationTime(node.Op),
-			Priority:      parser.GetOperationPriority(node.Op),
+	if !expr.IsActive() {
+		return s.recordResult(exprID, res, http.StatusConflict, "Выражение уже не вычисляется")
+	}
+
+	// Если пришла ошибка вычисления (например, деление на ноль)
+	if res.Error != "" {
+		if !s.transition(expr, models.StatusError) {
+			return s.recordResult(exprID, res, http.StatusConflict, "Выражение уже не вычисляется")
 		}
-		node.Scheduled = true
+		s.recordResult(exprID, res, http.StatusUnprocessableEntity, res.Error)
+		now := time.Now()
+		expr.ErrorCode = models.ErrorCodeEvaluation
+		expr.Error = res.Error
+		expr.FinishedAt = &now
+		s.indexExpression(expr)
+		s.notifyStatus(expr)
 		s.QueueMutex.Lock()
-		heap.Push(&s.TaskQueue, task)
+		s.TaskQueue.Remove(func(task *models.Task) bool {
+			return task.ExpressionID == exprID
+		})
 		s.QueueMutex.Unlock()
-		log.Printf("Запланирована задача для узла %s: %f %s %f, приоритет %d", node.ID, node.Left.Value, node.Op, node.Right.Value, task.Priority)
+		log.Printf("Выражение %s завершилось ошибкой в узле %s: %s", exprID, node.ID, res.Error)
+		s.recordExpression(models.EventError, expr)
+		s.startWebhook(expr)
+		s.forgetRevoked(exprID)
+		return http.StatusUnprocessableEntity, res.Error
+	}
+
+	s.recordResult(exprID, res, http.StatusOK, "результат записан")
+	computed := 1
+	if !node.IsReady() {
+		computed += applySubtreeResult(node, res.Timings)
+	}
+	node.Value = res.Result
+	node.Computed = true
+	expr.ComputedNodes += computed
+	log.Printf("Обновлен узел %s: результат %f", node.ID, res.Result)
+	for _, timing := range res.Timings {
+		if timing.ID != node.ID {
+			s.notifyNode(expr, timing.ID, timing.Result)
+		}
+	}
+	s.notifyNode(expr, node.ID, res.Result)
+	if node.Parent != nil {
+		s.scheduleParent(expr, node)
+	} else if s.transition(expr, models.StatusCompleted) {
+		now := time.Now()
+		expr.Result = &res.Result
+		expr.FinishedAt = &now
+		log.Printf("Выражение %s полностью вычислено: %f", exprID, res.Result)
+		s.recordExpression(models.EventCompleted, expr)
+		s.notifyStatus(expr)
+		s.startWebhook(expr)
+		s.forgetRevoked(exprID)
+	}
+	s.indexExpression(expr)
+	return http.StatusOK, "результат записан"
+}
+
+// findNode ищет узел задачи. Идентификатор узла начинается с
+// идентификатора выражения, поэтому сначала проверяется дерево этого
+// выражения, и лишь затем — все остальные. Вызывается под s.Mutex.
+func (s *Server) findNode(taskID string) (string, *parser.Node) {
+	if i := strings.LastIndex(taskID, "-"); i > 0 {
+		if root, ok := s.ASTs[taskID[:i]]; ok {
+			if node := parser.FindNodeByID(root, taskID); node != nil {
+				return taskID[:i], node
+			}
+		}
+	}
+	for exprID, root := range s.ASTs {
+		if node := parser.FindNodeByID(root, taskID); node != nil {
+			return exprID, node
+		}
+	}
+	return "", nil
+}
+
+// scheduleReadyTasks ставит в очередь задачи для всех готовых узлов
+// поддерева. Вызывается под s.Mutex.
+func (s *Server) scheduleReadyTasks(expr *models.Expression, node *parser.Node) {
+	if node == nil || node.Computed {
+		return
+	}
+	if s.canSchedule(node) {
+		s.scheduleNode(expr, node)
+		return
+	}
+	s.scheduleReadyTasks(expr, node.Left)
+	s.scheduleReadyTasks(expr, node.Right)
+}
+
+// newTask формирует задачу для готового к вычислению узла выражения.
+func newTask(expr *models.Expression, node *parser.Node) *models.Task {
+	return &models.Task{
+		ID:                 node.ID,
+		ExpressionID:       expr.ID,
+		Arg1:               node.Left.Value,
+		Arg2:               node.Right.Value,
+		Operation:          node.Op,
+		OperationTime:      parser.GetOperationTime(node.Op),
+		Priority:           parser.GetNodePriority(node),
+		ExpressionPriority: expr.Priority,
+		Deadline:           expr.Deadline,
 	}
-	s.scheduleReadyTasks(exprID, node.Left)
-	s.scheduleReadyTasks(exprID, node.Right)
 }
@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval — как часто Drain проверяет, остались ли выданные задачи.
+const drainPollInterval = 50 * time.Millisecond
+
+// ShutdownReport описывает состояние, оставшееся незавершённым при остановке.
+type ShutdownReport struct {
+	PendingExpressions int
+	QueuedTasks        int
+	DispatchedTasks    int
+}
+
+// BeginShutdown переводит сервер в режим остановки: новые выражения и
+// запросы задач отклоняются со статусом 503, ожидающие задачу агенты
+// освобождаются, а результаты уже выданных задач по-прежнему принимаются.
+func (s *Server) BeginShutdown() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+// shuttingDown сообщает, вызван ли BeginShutdown.
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain дожидается результатов всех выданных агентам задач или отмены ctx и
+// возвращает отчёт о том, что осталось невычисленным.
+func (s *Server) Drain(ctx context.Context) ShutdownReport {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for s.dispatchedCount() > 0 {
+		select {
+		case <-ctx.Done():
+			return s.Report()
+		case <-ticker.C:
+		}
+	}
+	return s.Report()
+}
+
+// Report возвращает число вычисляемых выражений, задач в очереди и задач,
+// выданных агентам без результата.
+func (s *Server) Report() ShutdownReport {
+	var report ShutdownReport
+	s.Mutex.Lock()
+	for _, expr := range s.Expressions {
+		if expr.IsActive() {
+			report.PendingExpressions++
+		}
+	}
+	s.Mutex.Unlock()
+	s.QueueMutex.Lock()
+	report.QueuedTasks = s.TaskQueue.Len()
+	s.QueueMutex.Unlock()
+	report.DispatchedTasks = s.dispatchedCount()
+	return report
+}
+
+func (s *Server) dispatchedCount() int {
+	s.AgentsMutex.Lock()
+	defer s.AgentsMutex.Unlock()
+	return len(s.dispatched)
+}
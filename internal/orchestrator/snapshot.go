@@ -0,0 +1,208 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/fsutil"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// snapshotVersion — версия формата файла снимка.
+const snapshotVersion = 1
+
+// snapshot — сохраняемое на диск состояние оркестратора.
+type snapshot struct {
+	Version     int                           `json:"version"`
+	TakenAt     time.Time                     `json:"taken_at"`
+	Expressions map[string]*models.Expression `json:"expressions"`
+	ASTs        map[string]*parser.NodeState  `json:"asts"`
+	// Queue — задачи в очереди в порядке поступления.
+	Queue []*models.Task `json:"queue"`
+	// Dispatched — задачи, выданные агентам и оставшиеся без результата.
+	Dispatched []*models.Task `json:"dispatched"`
+	// Revoked — агенты, чьи запоздавшие результаты принимаются: и те, у
+	// кого задачу отозвали, и те, кому она была выдана на момент снимка.
+	Revoked map[string][]string         `json:"revoked,omitempty"`
+	Acks    map[string]models.ResultAck `json:"acks,omitempty"`
+}
+
+// SaveSnapshot атомарно записывает состояние выражений, их деревьев и
+// очереди задач в файл path.
+func (s *Server) SaveSnapshot(path string) error {
+	snap := snapshot{
+		Version:     snapshotVersion,
+		TakenAt:     time.Now(),
+		Expressions: make(map[string]*models.Expression),
+		ASTs:        make(map[string]*parser.NodeState),
+		Revoked:     make(map[string][]string),
+		Acks:        make(map[string]models.ResultAck),
+	}
+
+	// Под s.Mutex не меняются деревья и не принимаются результаты, поэтому
+	// очередь и выданные задачи согласованы с деревьями.
+	s.Mutex.Lock()
+	for id, expr := range s.Expressions {
+		copied := *expr
+		snap.Expressions[id] = &copied
+	}
+	for id, root := range s.ASTs {
+		snap.ASTs[id] = parser.ToState(root)
+	}
+	for id, ack := range s.acks {
+		snap.Acks[id] = ack
+	}
+	s.QueueMutex.Lock()
+	snap.Queue = s.TaskQueue.Tasks()
+	s.QueueMutex.Unlock()
+	s.AgentsMutex.Lock()
+	for taskID, agents := range s.revoked {
+		snap.Revoked[taskID] = append([]string(nil), agents...)
+	}
+	for _, d := range s.dispatched {
+		snap.Dispatched = append(snap.Dispatched, d.task)
+		snap.Revoked[d.task.ID] = append(snap.Revoked[d.task.ID], d.agentID)
+	}
+	s.AgentsMutex.Unlock()
+	s.Mutex.Unlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, data)
+}
+
+// LoadSnapshot восстанавливает состояние из файла path, если он существует.
+// Задачи, выданные агентам до остановки, снова ставятся в очередь, но
+// результаты этих агентов по-прежнему принимаются; узлы, задача для которых
+// потерялась между очередью и агентом, планируются заново.
+func (s *Server) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return errors.New("неподдерживаемая версия снимка")
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for id, expr := range snap.Expressions {
+		s.Expressions[id] = expr
+	}
+	for id, state := range snap.ASTs {
+		s.ASTs[id] = parser.FromState(state)
+	}
+	for _, ack := range snap.Acks {
+		s.rememberAck(ack)
+	}
+
+	s.index.Reset(s.Expressions)
+	s.rebuildBatches()
+	s.restoreTasks(append(snap.Queue, snap.Dispatched...))
+	s.restoreRevoked(snap.Revoked)
+	s.resumeWebhooks()
+	log.Printf("Состояние восстановлено из снимка %s от %s: выражений %d, задач в очереди %d, возвращено от агентов %d",
+		path, snap.TakenAt.Format(time.RFC3339), len(snap.Expressions), len(snap.Queue), len(snap.Dispatched))
+	return nil
+}
+
+// RunSnapshots раз в interval сохраняет снимок состояния в path.
+// Блокируется до отмены ctx.
+func (s *Server) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SaveSnapshot(path); err != nil {
+				log.Printf("Ошибка при сохранении снимка %s: %v", path, err)
+			}
+		}
+	}
+}
+
+// restoreTasks ставит в очередь восстановленные задачи вычисляемых выражений,
+// а узлы, отмеченные запланированными, но не покрытые ни одной задачей,
+// планирует заново. Вызывается под s.Mutex.
+func (s *Server) restoreTasks(tasks []*models.Task) {
+	covered := make(map[string]bool)
+	for _, task := range tasks {
+		if expr, ok := s.Expressions[task.ExpressionID]; !ok || !expr.IsActive() {
+			continue
+		}
+		if _, node := s.findNode(task.ID); node == nil || node.Computed || covered[task.ID] {
+			continue
+		}
+		covered[task.ID] = true
+		for _, id := range subtreeIDs(task.Subtree) {
+			covered[id] = true
+		}
+		s.pushTask(task)
+	}
+	for id, expr := range s.Expressions {
+		if !expr.IsActive() {
+			continue
+		}
+		unscheduleUncovered(s.ASTs[id], covered)
+		s.scheduleReadyTasks(expr, s.ASTs[id])
+	}
+}
+
+// restoreRevoked восстанавливает список агентов, чьи запоздавшие результаты
+// принимаются, для ещё не вычисленных задач вычисляемых выражений.
+// Вызывается под s.Mutex.
+func (s *Server) restoreRevoked(revoked map[string][]string) {
+	s.AgentsMutex.Lock()
+	defer s.AgentsMutex.Unlock()
+	for taskID, agents := range revoked {
+		exprID, node := s.findNode(taskID)
+		if node == nil || node.Computed {
+			continue
+		}
+		if expr, ok := s.Expressions[exprID]; !ok || !expr.IsActive() {
+			continue
+		}
+		for _, agentID := range agents {
+			if !s.wasRevoked(taskID, agentID) {
+				s.revoked[taskID] = append(s.revoked[taskID], agentID)
+			}
+		}
+	}
+}
+
+// subtreeIDs возвращает идентификаторы операций объединённого поддерева.
+func subtreeIDs(node *models.TaskNode) []string {
+	if node == nil || node.Operation == "" {
+		return nil
+	}
+	return append(append([]string{node.ID}, subtreeIDs(node.Left)...), subtreeIDs(node.Right)...)
+}
+
+// unscheduleUncovered снимает отметку Scheduled с невычисленных узлов, для
+// которых в снимке нет задачи, чтобы scheduleReadyTasks запланировал их заново.
+func unscheduleUncovered(node *parser.Node, covered map[string]bool) {
+	if node == nil || node.Computed {
+		return
+	}
+	if !covered[node.ID] {
+		node.Scheduled = false
+	}
+	unscheduleUncovered(node.Left, covered)
+	unscheduleUncovered(node.Right, covered)
+}
@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/storage"
+)
+
+// OpenStore открывает хранилище выражений по cfg. В надёжном режиме
+// выражения, которых ещё нет на сервере, восстанавливаются из хранилища:
+// завершённые — как есть, незавершённые вычисляются заново. После этого
+// каждое изменение выражения (приём, завершение, отправка уведомления)
+// сохраняется в хранилище. Запись идёт в фоне, вне s.Mutex: изменения,
+// накопившиеся за время предыдущего fsync, сохраняются одной пачкой. В режиме
+// памяти ничего не делает: выражения и так хранятся на сервере.
+func (s *Server) OpenStore(cfg storage.Config) error {
+	if cfg.Mode == storage.ModeMemory || cfg.Mode == "" {
+		return nil
+	}
+	store, err := storage.Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	store.Mutex.Lock()
+	stored := make([]*models.Expression, 0, len(store.Expressions))
+	for _, expr := range store.Expressions {
+		copied := *expr
+		stored = append(stored, &copied)
+	}
+	store.Mutex.Unlock()
+	sort.Slice(stored, func(i, j int) bool {
+		if !stored[i].CreatedAt.Equal(stored[j].CreatedAt) {
+			return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+		}
+		return stored[i].ID < stored[j].ID
+	})
+
+	var report ImportReport
+	for _, expr := range stored {
+		imported := report.Imported
+		if err := s.importExpression(expr, &report); err != nil {
+			log.Printf("Выражение %s из хранилища не восстановлено: %v", expr.ID, err)
+			continue
+		}
+		// Незавершённая до остановки отправка уведомления возобновляется.
+		if report.Imported > imported && expr.Webhook != nil && expr.Webhook.Status == models.WebhookPending {
+			go s.deliverWebhook(expr.ID)
+		}
+	}
+	s.Store = store
+	s.storeWriter = newStoreWriter(store)
+	log.Printf("Хранилище %s открыто: восстановлено выражений %d, вычисляются заново %d",
+		cfg.Dir, report.Imported, report.Rescheduled)
+	return nil
+}
+
+// CloseStore дожидается сохранения накопленных изменений и закрывает
+// хранилище. Вызывается, когда выражения больше не меняются.
+func (s *Server) CloseStore() error {
+	if s.Store == nil {
+		return nil
+	}
+	s.storeWriter.close()
+	return s.Store.Close()
+}
+
+// storeWriter сохраняет выражения в хранилище в фоне. save вызывается под
+// s.Mutex и только ставит выражение в очередь, а fsync и сворачивание
+// журнала хранилища происходят в отдельной горутине.
+type storeWriter struct {
+	store *storage.MemoryStore
+
+	mu      sync.Mutex
+	pending []*models.Expression
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newStoreWriter(store *storage.MemoryStore) *storeWriter {
+	w := &storeWriter{store: store, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go w.loop(w.wake)
+	return w
+}
+
+// save ставит в очередь состояние выражения. expr не должен меняться после
+// вызова.
+func (w *storeWriter) save(expr *models.Expression) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wake == nil {
+		return
+	}
+	w.pending = append(w.pending, expr)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop сохраняет накопленные выражения, пока запись не остановлена.
+func (w *storeWriter) loop(wake <-chan struct{}) {
+	defer close(w.done)
+	for range wake {
+		w.flush()
+	}
+	w.flush()
+}
+
+// flush сохраняет накопленные выражения. Из нескольких состояний одного
+// выражения сохраняется последнее.
+func (w *storeWriter) flush() {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	last := make(map[string]int, len(batch))
+	for i, expr := range batch {
+		last[expr.ID] = i
+	}
+	exprs := batch[:0]
+	for i, expr := range batch {
+		if last[expr.ID] == i {
+			exprs = append(exprs, expr)
+		}
+	}
+	if err := w.store.SaveExpressions(exprs); err != nil {
+		log.Printf("Ошибка сохранения выражений в хранилище: %v", err)
+	}
+}
+
+// close сохраняет оставшиеся выражения и останавливает запись.
+func (w *storeWriter) close() {
+	w.mu.Lock()
+	if w.wake == nil {
+		w.mu.Unlock()
+		return
+	}
+	close(w.wake)
+	w.wake = nil
+	w.mu.Unlock()
+	<-w.done
+}
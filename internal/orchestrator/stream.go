@@ -0,0 +1,236 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// taskStream — постоянное соединение с агентом и задачи, выданные через него,
+// на которые ещё не пришёл результат.
+type taskStream struct {
+	agentID  string
+	accept   func(*models.Task) bool
+	mu       sync.Mutex
+	inFlight map[string]*dispatch
+	slots    chan struct{}
+}
+
+// openStream регистрирует новое потоковое соединение агента ёмкостью
+// capacity, выполняющего операции ops (пустой список — заявленные при регистрации).
+func (s *Server) openStream(agentID string, capacity int, ops []string) *taskStream {
+	stream := &taskStream{
+		agentID:  agentID,
+		accept:   s.taskFilter(agentID, ops),
+		inFlight: make(map[string]*dispatch),
+		slots:    make(chan struct{}, capacity),
+	}
+	s.streamsMutex.Lock()
+	s.streams[stream] = struct{}{}
+	s.streamsMutex.Unlock()
+	return stream
+}
+
+// closeStream снимает соединение с учёта и возвращает в очередь задачи,
+// результат которых по нему так и не пришёл.
+func (s *Server) closeStream(stream *taskStream) int {
+	s.streamsMutex.Lock()
+	delete(s.streams, stream)
+	s.streamsMutex.Unlock()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for _, d := range stream.inFlight {
+		s.requeueDispatch(d)
+	}
+	return len(stream.inFlight)
+}
+
+// releaseStreamTask освобождает место в соединении агента agentID, через
+// которое была выдана задача, если она выдавалась через поток.
+func (s *Server) releaseStreamTask(agentID, taskID string) {
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	for stream := range s.streams {
+		if stream.agentID != agentID {
+			continue
+		}
+		stream.mu.Lock()
+		_, ok := stream.inFlight[taskID]
+		delete(stream.inFlight, taskID)
+		stream.mu.Unlock()
+		if ok {
+			<-stream.slots
+			return
+		}
+	}
+}
+
+// streamTasks отправляет агенту задачи по мере их появления, пока у агента
+// есть свободные места, send не вернул ошибку и ctx не отменён. При
+// остановке сервера новые задачи не отправляются, но соединение остаётся
+// открытым до получения результатов уже отправленных.
+func (s *Server) streamTasks(ctx context.Context, stream *taskStream, send func(*models.Task) error) {
+	for {
+		select {
+		case stream.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		task := s.waitTask(ctx, stream.accept)
+		if task == nil {
+			if s.shuttingDown() {
+				<-stream.slots
+				s.drainStream(ctx, stream)
+			}
+			return
+		}
+		d := s.markDispatched(task, stream.agentID)
+		stream.mu.Lock()
+		stream.inFlight[task.ID] = d
+		stream.mu.Unlock()
+
+		if err := send(task); err != nil {
+			return
+		}
+		log.Printf("Задача %s отправлена агенту по потоку: %+v", task.ID, task)
+	}
+}
+
+// drainStream ждёт результатов всех задач, отправленных по соединению:
+// каждый результат освобождает место, и соединение свободно, когда заняты
+// все места.
+func (s *Server) drainStream(ctx context.Context, stream *taskStream) {
+	for i := 0; i < cap(stream.slots); i++ {
+		select {
+		case stream.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleTaskStream переключает соединение на WebSocket (подпротокол
+// models.StreamProtocol): оркестратор сам отправляет агенту готовые задачи,
+// не более capacity одновременно, и принимает результаты по тому же
+// соединению. При разрыве соединения невыполненные задачи возвращаются в очередь.
+func (s *Server) handleTaskStream(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "Требуется WebSocket-соединение", http.StatusUpgradeRequired)
+		return
+	}
+	capacity := 1
+	if capStr := r.URL.Query().Get("capacity"); capStr != "" {
+		val, err := strconv.Atoi(capStr)
+		if err != nil || val <= 0 {
+			http.Error(w, "Неверная ёмкость агента", http.StatusBadRequest)
+			return
+		}
+		capacity = val
+	}
+	websocket.Server{
+		Handshake: acceptStreamProtocol,
+		Handler: func(ws *websocket.Conn) {
+			s.serveTaskStream(ws, r, capacity)
+		},
+	}.ServeHTTP(w, r)
+}
+
+// acceptStreamProtocol проверяет, что агент запросил подпротокол
+// models.StreamProtocol. Origin не проверяется: к эндпоинту обращаются
+// агенты, а не браузеры.
+func acceptStreamProtocol(config *websocket.Config, r *http.Request) error {
+	for _, protocol := range config.Protocol {
+		if protocol == models.StreamProtocol {
+			config.Protocol = []string{protocol}
+			return nil
+		}
+	}
+	return fmt.Errorf("не запрошен подпротокол %s", models.StreamProtocol)
+}
+
+// serveTaskStream обслуживает установленное соединение агента.
+func (s *Server) serveTaskStream(ws *websocket.Conn, r *http.Request, capacity int) {
+	defer ws.Close()
+	log.Printf("Агент %s подключён в потоковом режиме, ёмкость %d", r.RemoteAddr, capacity)
+
+	query := r.URL.Query()
+	stream := s.openStream(query.Get("agent_id"), capacity, parseOperations(query.Get("ops")))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.streamTasks(ctx, stream, func(task *models.Task) error {
+			return websocket.JSON.Send(ws, models.StreamMessage{Type: models.StreamTask, Task: task})
+		})
+		// Запись невозможна — закрываем соединение, чтобы завершить чтение.
+		ws.Close()
+	}()
+
+	s.readStreamResults(ws, stream.agentID)
+	cancel()
+	<-done
+
+	requeued := s.closeStream(stream)
+	log.Printf("Агент %s отключён, возвращено задач в очередь: %d", r.RemoteAddr, requeued)
+}
+
+// readStreamResults принимает результаты задач агента agentID до разрыва
+// соединения.
+func (s *Server) readStreamResults(ws *websocket.Conn, agentID string) {
+	for {
+		var msg models.StreamMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		if msg.Type != models.StreamResult || msg.Result == nil {
+			log.Printf("Неожиданное сообщение в потоке агента: %+v", msg)
+			continue
+		}
+		if status, message := s.applyResult(agentID, *msg.Result); status != http.StatusOK {
+			log.Printf("Результат задачи %s из потока не принят: %s", msg.Result.ID, message)
+		}
+	}
+}
+
+// requeueDispatch возвращает в очередь задачу выдачи d, результат которой
+// не был получен, если её выражение ещё вычисляется. Выдача, уже снятая с
+// учёта (получен результат, задача возвращена раньше или выдана заново
+// другому агенту), повторно не возвращается.
+func (s *Server) requeueDispatch(d *dispatch) {
+	s.AgentsMutex.Lock()
+	current := s.dispatched[d.task.ID] == d
+	if current {
+		delete(s.dispatched, d.task.ID)
+		if !s.wasRevoked(d.task.ID, d.agentID) {
+			s.revoked[d.task.ID] = append(s.revoked[d.task.ID], d.agentID)
+		}
+	}
+	s.AgentsMutex.Unlock()
+	if !current {
+		return
+	}
+	task := d.task
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	expr, ok := s.Expressions[task.ExpressionID]
+	if !ok || !expr.IsActive() {
+		return
+	}
+	if _, node := s.findNode(task.ID); node == nil || node.Computed {
+		return
+	}
+	s.pushTask(task)
+	s.record(models.Event{Type: models.EventTaskRequeued, ExpressionID: task.ExpressionID, TaskID: task.ID})
+	log.Printf("Задача %s возвращена в очередь", task.ID)
+}
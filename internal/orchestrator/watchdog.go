@@ -0,0 +1,35 @@
+package orchestrator
+
+import (
+	"context"
+	"time"
+)
+
+// RunWatchdog периодически проверяет вычисляемые выражения и завершает по
+// таймауту те, срок вычисления которых истёк, удаляя их задачи из очереди,
+// а также возвращает в очередь задачи агентов, переставших присылать пульс.
+// Блокируется до отмены ctx.
+func (s *Server) RunWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expireOverdue(now)
+			s.reapAgents(now)
+		}
+	}
+}
+
+// expireOverdue завершает по таймауту все просроченные к моменту now выражения.
+func (s *Server) expireOverdue(now time.Time) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for exprID, expr := range s.Expressions {
+		if expr.IsActive() && expr.Overdue(now) {
+			s.expireExpression(exprID)
+		}
+	}
+}
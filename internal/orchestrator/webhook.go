@@ -0,0 +1,218 @@
+package orchestrator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/retry"
+)
+
+// Заголовки уведомления о завершении выражения.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	webhookExpressionIDHdr = "X-Expression-ID"
+)
+
+// errWebhookForbidden означает, что адрес уведомления ведёт во внутреннюю сеть.
+var errWebhookForbidden = errors.New("адрес во внутренней сети запрещён")
+
+// validateCallbackURL проверяет, что уведомления включены, а адрес — абсолютный
+// HTTP(S) URL, не указывающий явно на внутренний адрес. Адреса, заданные
+// именем, проверяются при подключении (см. dialWebhook).
+func (s *Server) validateCallbackURL(raw string) error {
+	if s.WebhookSecret == "" {
+		return errors.New("уведомления отключены: не задан WEBHOOK_SECRET")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("нужен абсолютный адрес HTTP или HTTPS: %q", raw)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	ip := net.ParseIP(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	if ip != nil && !s.webhookIPAllowed(ip) {
+		return errWebhookForbidden
+	}
+	return nil
+}
+
+// webhookIPAllowed сообщает, можно ли отправлять уведомления на адрес ip:
+// адреса внутренних сетей (loopback, частные, link-local, групповые)
+// запрещены, если не входят в WebhookAllowedNets.
+func (s *Server) webhookIPAllowed(ip net.IP) bool {
+	for _, allowed := range s.WebhookAllowedNets {
+		if allowed.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// newWebhookClient создаёт HTTP-клиент уведомлений. Адрес проверяется после
+// разрешения имени, непосредственно перед подключением, поэтому ни
+// перенаправление, ни смена DNS-записи не ведут во внутреннюю сеть.
+// Прокси не используется: иначе проверялся бы адрес прокси.
+func (s *Server) newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: s.dialWebhook}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}
+}
+
+// dialWebhook запрещает подключение к внутренним адресам.
+func (s *Server) dialWebhook(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !s.webhookIPAllowed(ip) {
+		return fmt.Errorf("%w: %s", errWebhookForbidden, host)
+	}
+	return nil
+}
+
+// SignWebhook возвращает значение заголовка X-Webhook-Signature для тела
+// body: HMAC-SHA256 с ключом secret в шестнадцатеричном виде.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// startWebhook запускает отправку уведомления о завершении выражения, если
+// клиент указал callback_url. Вызывается под s.Mutex.
+func (s *Server) startWebhook(expr *models.Expression) {
+	if expr.CallbackURL == "" || expr.Webhook != nil {
+		return
+	}
+	expr.Webhook = &models.WebhookDelivery{Status: models.WebhookPending}
+	s.recordExpression(models.EventWebhook, expr)
+	go s.deliverWebhook(expr.ID)
+}
+
+// resumeWebhooks возобновляет отправку уведомлений, не завершённую до
+// остановки. Вызывается под s.Mutex после восстановления состояния.
+func (s *Server) resumeWebhooks() {
+	for id, expr := range s.Expressions {
+		if expr.Webhook != nil && expr.Webhook.Status == models.WebhookPending {
+			go s.deliverWebhook(id)
+		}
+	}
+}
+
+// deliverWebhook отправляет выражение на его callback_url, повторяя
+// попытки с растущей задержкой при сетевых ошибках и ответах 5xx, 408 и
+// 429. Итог каждой попытки записывается в выражение.
+func (s *Server) deliverWebhook(exprID string) {
+	s.Mutex.Lock()
+	expr, ok := s.Expressions[exprID]
+	if !ok || expr.Webhook == nil {
+		s.Mutex.Unlock()
+		return
+	}
+	payload := *expr
+	payload.Webhook = nil
+	target, attempts := expr.CallbackURL, expr.Webhook.Attempts
+	s.Mutex.Unlock()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Ошибка подготовки уведомления о выражении %s: %v", exprID, err)
+		return
+	}
+	backoff := &retry.Backoff{Base: s.WebhookRetryBase, Max: s.WebhookRetryMax}
+	for attempts < s.WebhookMaxAttempts {
+		if attempts > 0 {
+			select {
+			case <-time.After(backoff.Delay(attempts - 1)):
+			case <-s.closing:
+				return
+			}
+		}
+		attempts++
+		retry, err := s.postWebhook(target, exprID, body)
+		s.updateWebhook(exprID, attempts, err, !retry || attempts >= s.WebhookMaxAttempts)
+		if err == nil || !retry {
+			return
+		}
+		log.Printf("Уведомление о выражении %s не доставлено (попытка %d): %v", exprID, attempts, err)
+	}
+}
+
+// postWebhook выполняет одну попытку отправки. retry сообщает, стоит ли
+// повторять попытку при ошибке.
+func (s *Server) postWebhook(target, exprID string, body []byte) (retry bool, err error) {
+	// Выражение могло быть принято до того, как ключ подписи убрали.
+	if s.WebhookSecret == "" {
+		return false, errors.New("не задан WEBHOOK_SECRET")
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookExpressionIDHdr, exprID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(s.WebhookSecret, body))
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return !errors.Is(err, errWebhookForbidden), err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("получатель ответил %s", resp.Status)
+	default:
+		return false, fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+}
+
+// updateWebhook записывает итог попытки отправки; final — попыток больше не будет.
+func (s *Server) updateWebhook(exprID string, attempts int, err error, final bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	expr, ok := s.Expressions[exprID]
+	if !ok || expr.Webhook == nil {
+		return
+	}
+	delivery := *expr.Webhook
+	delivery.Attempts = attempts
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = models.WebhookDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		log.Printf("Уведомление о выражении %s доставлено", exprID)
+	case final:
+		delivery.Status = models.WebhookFailed
+		delivery.LastError = err.Error()
+		log.Printf("Уведомление о выражении %s не доставлено: %v", exprID, err)
+	default:
+		delivery.LastError = err.Error()
+	}
+	expr.Webhook = &delivery
+	s.indexExpression(expr)
+	if delivery.Status != models.WebhookPending {
+		s.recordExpression(models.EventWebhook, expr)
+	}
+}
@@ -29,14 +29,20 @@ func (n *Node) IsReady() bool {
 }
 
 func ParseExpression(expression string) (*Node, error) {
+	return ParseExpressionWithVars(expression, nil)
+}
+
+// ParseExpressionWithVars разбирает выражение, подставляя вместо
+// идентификаторов значения переменных vars.
+func ParseExpressionWithVars(expression string, vars map[string]float64) (*Node, error) {
 	expr, err := goParser.ParseExpr(expression)
 	if err != nil {
 		return nil, err
 	}
-	return buildAST(expr)
+	return buildAST(expr, vars)
 }
 
-func buildAST(expr ast.Expr) (*Node, error) {
+func buildAST(expr ast.Expr, vars map[string]float64) (*Node, error) {
 	switch e := expr.(type) {
 	case *ast.BasicLit:
 		value, err := strconv.ParseFloat(strings.Trim(e.Value, "\""), 64)
@@ -48,12 +54,22 @@ func buildAST(expr ast.Expr) (*Node, error) {
 			Computed: true,
 		}, nil
 
+	case *ast.Ident:
+		value, ok := vars[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("неизвестная переменная: %s", e.Name)
+		}
+		return &Node{
+			Value:    value,
+			Computed: true,
+		}, nil
+
 	case *ast.BinaryExpr:
-		left, err := buildAST(e.X)
+		left, err := buildAST(e.X, vars)
 		if err != nil {
 			return nil, err
 		}
-		right, err := buildAST(e.Y)
+		right, err := buildAST(e.Y, vars)
 		if err != nil {
 			return nil, err
 		}
@@ -68,7 +84,7 @@ func buildAST(expr ast.Expr) (*Node, error) {
 		return node, nil
 
 	case *ast.ParenExpr:
-		return buildAST(e.X)
+		return buildAST(e.X, vars)
 
 	default:
 		return nil, fmt.Errorf("неподдерживаемый тип выражения: %T", e)
@@ -109,6 +125,23 @@ func FindNodeByID(node *Node, id string) *Node {
 	return FindNodeByID(node.Right, id)
 }
 
+// CountOperations возвращает число операций в дереве и число уже вычисленных из них.
+func CountOperations(node *Node) (total, computed int) {
+	if node == nil || node.Op == "" {
+		return 0, 0
+	}
+	total, computed = 1, 0
+	if node.Computed {
+		computed = 1
+	}
+	for _, child := range []*Node{node.Left, node.Right} {
+		t, c := CountOperations(child)
+		total += t
+		computed += c
+	}
+	return total, computed
+}
+
 func GetOperationTime(op string) int {
 	var envVar string
 	switch op {
@@ -155,6 +188,7 @@ func GetOperationTime(op string) int {
 	return val
 }
 
+// GetOperationPriority возвращает фиксированный приоритет операции по её типу.
 func GetOperationPriority(op string) int {
 	switch op {
 	case "*", "/":
@@ -165,3 +199,28 @@ func GetOperationPriority(op string) int {
 		return 0
 	}
 }
+
+// CriticalPathTime возвращает длину оставшегося критического пути узла —
+// суммарное время операций от узла до корня дерева включительно.
+// Чем длиннее путь, тем больше последующей работы блокирует узел.
+func CriticalPathTime(node *Node) int {
+	total := 0
+	for n := node; n != nil; n = n.Parent {
+		if n.Op != "" {
+			total += GetOperationTime(n.Op)
+		}
+	}
+	return total
+}
+
+// GetNodePriority возвращает приоритет задачи для узла в зависимости от
+// эвристики, заданной переменной окружения PRIORITY_HEURISTIC:
+// "critical_path" (по умолчанию) или "operator".
+func GetNodePriority(node *Node) int {
+	switch os.Getenv("PRIORITY_HEURISTIC") {
+	case "operator":
+		return GetOperationPriority(node.Op)
+	default:
+		return CriticalPathTime(node)
+	}
+}
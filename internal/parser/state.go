@@ -0,0 +1,52 @@
+package parser
+
+// NodeState — сериализуемая форма узла дерева: без ссылки на родителя,
+// которая делает Node циклической структурой. Родители восстанавливаются
+// функцией FromState.
+type NodeState struct {
+	ID        string     `json:"id"`
+	Op        string     `json:"op,omitempty"`
+	Value     float64    `json:"value"`
+	Computed  bool       `json:"computed,omitempty"`
+	Scheduled bool       `json:"scheduled,omitempty"`
+	Left      *NodeState `json:"left,omitempty"`
+	Right     *NodeState `json:"right,omitempty"`
+}
+
+// ToState переводит дерево в сериализуемую форму.
+func ToState(node *Node) *NodeState {
+	if node == nil {
+		return nil
+	}
+	return &NodeState{
+		ID:        node.ID,
+		Op:        node.Op,
+		Value:     node.Value,
+		Computed:  node.Computed,
+		Scheduled: node.Scheduled,
+		Left:      ToState(node.Left),
+		Right:     ToState(node.Right),
+	}
+}
+
+// FromState восстанавливает дерево вместе со ссылками на родителей.
+func FromState(state *NodeState) *Node {
+	return fromState(state, nil)
+}
+
+func fromState(state *NodeState, parent *Node) *Node {
+	if state == nil {
+		return nil
+	}
+	node := &Node{
+		ID:        state.ID,
+		Op:        state.Op,
+		Value:     state.Value,
+		Computed:  state.Computed,
+		Scheduled: state.Scheduled,
+		Parent:    parent,
+	}
+	node.Left = fromState(state.Left, node)
+	node.Right = fromState(state.Right, node)
+	return node
+}
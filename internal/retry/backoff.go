@@ -0,0 +1,45 @@
+// Package retry содержит общую политику повторных попыток агента и
+// оркестратора.
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff вычисляет паузы между повторными попытками: каждая следующая
+// пауза вдвое длиннее предыдущей, но не больше Max, а случайная добавка
+// (от половины паузы до полной) разносит попытки разных клиентов во времени.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	attempt int
+}
+
+// Next возвращает паузу перед следующей попыткой.
+func (b *Backoff) Next() time.Duration {
+	d := b.Delay(b.attempt)
+	b.attempt++
+	return d
+}
+
+// Delay возвращает паузу после attempt неудачных попыток, не считая первой:
+// для attempt = 0 это пауза порядка Base.
+func (b *Backoff) Delay(attempt int) time.Duration {
+	d := b.Max
+	if attempt < 32 {
+		if exp := b.Base << uint(attempt); exp > 0 && exp < b.Max {
+			d = exp
+		}
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Reset сбрасывает счётчик попыток после успешной операции.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
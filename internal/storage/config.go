@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Режимы хранилища, задаваемые переменной окружения STORAGE_MODE.
+const (
+	ModeMemory  = "memory"
+	ModeDurable = "durable"
+)
+
+// Config описывает, какое хранилище открыть.
+type Config struct {
+	Mode         string
+	Dir          string
+	CompactEvery int
+}
+
+// ConfigFromEnv читает настройки хранилища из переменных окружения
+// STORAGE_MODE ("memory" по умолчанию или "durable"), STORAGE_DIR
+// (каталог журнала и снимка, по умолчанию "data") и STORAGE_COMPACT_EVERY.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Mode:         os.Getenv("STORAGE_MODE"),
+		Dir:          os.Getenv("STORAGE_DIR"),
+		CompactEvery: DefaultCompactEvery,
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeMemory
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "data"
+	}
+	if valStr := os.Getenv("STORAGE_COMPACT_EVERY"); valStr != "" {
+		val, err := strconv.Atoi(valStr)
+		if err != nil || val <= 0 {
+			log.Printf("Ошибка преобразования STORAGE_COMPACT_EVERY: %q", valStr)
+		} else {
+			cfg.CompactEvery = val
+		}
+	}
+	return cfg
+}
+
+// Open открывает хранилище в соответствии с cfg.
+func Open(cfg Config) (*MemoryStore, error) {
+	switch cfg.Mode {
+	case ModeMemory, "":
+		return NewMemoryStore(), nil
+	case ModeDurable:
+		return OpenDurable(cfg.Dir, cfg.CompactEvery)
+	default:
+		return nil, fmt.Errorf("неизвестный режим хранилища: %q", cfg.Mode)
+	}
+}
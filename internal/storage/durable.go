@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/fsutil"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	// DefaultCompactEvery — через сколько записей журнал сворачивается в
+	// снимок, если не задано иное.
+	DefaultCompactEvery = 1000
+)
+
+// walRecord — одна запись журнала. LSN растёт монотонно и позволяет при
+// восстановлении пропустить записи, уже вошедшие в снимок.
+type walRecord struct {
+	LSN        uint64             `json:"lsn"`
+	Op         string             `json:"op"`
+	ID         string             `json:"id"`
+	Expression *models.Expression `json:"expression,omitempty"`
+}
+
+const opSave = "save"
+
+// storeSnapshot — содержимое файла снимка.
+type storeSnapshot struct {
+	LSN         uint64                        `json:"lsn"`
+	Expressions map[string]*models.Expression `json:"expressions"`
+}
+
+type durableState struct {
+	dir          string
+	wal          *wal
+	lsn          uint64
+	compactEvery int
+	sinceCompact int
+}
+
+// OpenDurable открывает хранилище в каталоге dir в надёжном режиме:
+// состояние восстанавливается из снимка и журнала, а каждое следующее
+// изменение дописывается в журнал. Через каждые compactEvery записей
+// (DefaultCompactEvery, если значение не положительное) журнал
+// сворачивается в снимок. Оборванная последняя запись журнала, оставшаяся
+// после сбоя, отбрасывается, а повреждённая запись в середине журнала
+// считается ошибкой.
+func OpenDurable(dir string, compactEvery int) (*MemoryStore, error) {
+	if compactEvery <= 0 {
+		compactEvery = DefaultCompactEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := NewMemoryStore()
+	state := &durableState{dir: dir, compactEvery: compactEvery}
+
+	snapLSN, err := s.loadSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	state.lsn = snapLSN
+
+	w, err := openWAL(filepath.Join(dir, walFileName))
+	if err != nil {
+		return nil, err
+	}
+	err = w.readAll(func(payload []byte) error {
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return fmt.Errorf("запись журнала не разбирается: %w", err)
+		}
+		if rec.LSN <= snapLSN {
+			return nil
+		}
+		if rec.Op == opSave {
+			s.Expressions[rec.ID] = rec.Expression
+		}
+		state.lsn = rec.LSN
+		state.sinceCompact++
+		return nil
+	})
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	state.wal = w
+	s.durable = state
+	log.Printf("Хранилище восстановлено из %s: выражений %d, записей журнала после снимка %d",
+		dir, len(s.Expressions), state.sinceCompact)
+	return s, nil
+}
+
+func (s *MemoryStore) loadSnapshot(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var snap storeSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("снимок хранилища повреждён: %w", err)
+	}
+	for id, expr := range snap.Expressions {
+		s.Expressions[id] = expr
+	}
+	return snap.LSN, nil
+}
+
+// saveDurable записывает изменения в журнал и применяет их к памяти под
+// одной блокировкой, чтобы порядок записей в журнале совпадал с порядком
+// изменений. Ожидание fsync происходит уже без блокировки, поэтому
+// параллельные вызовы сбрасываются на диск одной группой.
+func (s *MemoryStore) saveDurable(exprs []*models.Expression) error {
+	s.Mutex.Lock()
+	d := s.durable
+	var seq uint64
+	for _, expr := range exprs {
+		rec := walRecord{LSN: d.lsn + 1, Op: opSave, ID: expr.ID, Expression: expr}
+		payload, err := json.Marshal(rec)
+		if err != nil {
+			s.Mutex.Unlock()
+			return err
+		}
+		if seq, err = d.wal.append(payload); err != nil {
+			s.Mutex.Unlock()
+			return err
+		}
+		d.lsn = rec.LSN
+		d.sinceCompact++
+		s.Expressions[expr.ID] = expr
+	}
+	compact := d.sinceCompact >= d.compactEvery
+	s.Mutex.Unlock()
+
+	if err := d.wal.sync(seq); err != nil {
+		return err
+	}
+	if compact {
+		if err := s.Compact(); err != nil {
+			log.Printf("Ошибка сворачивания журнала хранилища: %v", err)
+		}
+	}
+	return nil
+}
+
+// Compact записывает текущее состояние в снимок и очищает журнал. Если
+// сбой произойдёт между этими шагами, записи журнала, уже вошедшие в
+// снимок, будут пропущены при восстановлении по LSN.
+func (s *MemoryStore) Compact() error {
+	if s.durable == nil {
+		return nil
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	d := s.durable
+	data, err := json.Marshal(storeSnapshot{LSN: d.lsn, Expressions: s.Expressions})
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(d.dir, snapshotFileName), data); err != nil {
+		return err
+	}
+	if err := d.wal.reset(); err != nil {
+		return err
+	}
+	d.sinceCompact = 0
+	return nil
+}
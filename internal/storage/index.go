@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// SortFields — поля, по которым можно упорядочить список выражений.
+var SortFields = []string{"created_at", "started_at", "finished_at", "priority", "id"}
+
+// ListQuery — параметры выборки списка выражений.
+type ListQuery struct {
+	Status models.ExpressionStatus // пустой — все статусы
+	Since  time.Time               // выражения, созданные не раньше; нулевое — без ограничения
+	Limit  int                     // 0 — без ограничения
+	Cursor string                  // продолжение предыдущей страницы
+	Sort   string                  // поле из SortFields, "-" в начале — по убыванию
+}
+
+// ListPage — страница списка выражений.
+type ListPage struct {
+	Expressions []models.Expression
+	Total       int    // сколько всего выражений подходит под фильтр
+	NextCursor  string // пустой, если страница последняя
+}
+
+// ErrBadCursor означает, что курсор не разбирается или выдан для другой сортировки.
+var ErrBadCursor = errors.New("неверный курсор")
+
+// ExpressionIndex хранит копии выражений и для каждого поля сортировки —
+// их ID, упорядоченные по (значение поля, ID), как по всем выражениям, так
+// и отдельно по каждому статусу, чтобы выборка страницы не требовала ни
+// общей блокировки сервера, ни сортировки. Порядок полный, поэтому курсор
+// однозначно задаёт продолжение списка даже при добавлении новых выражений.
+type ExpressionIndex struct {
+	mu     sync.RWMutex
+	byID   map[string]models.Expression
+	orders map[orderKey][]indexEntry
+}
+
+// orderKey выбирает упорядоченный список: пустой статус — все выражения.
+type orderKey struct {
+	status models.ExpressionStatus
+	field  string
+}
+
+// indexEntry — позиция выражения в упорядоченном списке.
+type indexEntry struct {
+	key int64
+	id  string
+}
+
+func (e indexEntry) less(other indexEntry) bool {
+	if e.key != other.key {
+		return e.key < other.key
+	}
+	return e.id < other.id
+}
+
+// NewExpressionIndex возвращает пустой индекс.
+func NewExpressionIndex() *ExpressionIndex {
+	return &ExpressionIndex{
+		byID:   make(map[string]models.Expression),
+		orders: make(map[orderKey][]indexEntry),
+	}
+}
+
+// Put добавляет копию выражения в индекс или обновляет её. Упорядоченные
+// списки меняются, только если изменился статус или значение поля.
+func (x *ExpressionIndex) Put(expr models.Expression) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	old, exists := x.byID[expr.ID]
+	for _, field := range SortFields {
+		entry := indexEntry{key: sortKey(&expr, field), id: expr.ID}
+		if exists {
+			oldEntry := indexEntry{key: sortKey(&old, field), id: old.ID}
+			if oldEntry == entry && old.Status == expr.Status {
+				continue
+			}
+			if oldEntry != entry {
+				x.remove(orderKey{field: field}, oldEntry)
+				x.insert(orderKey{field: field}, entry)
+			}
+			x.remove(orderKey{status: old.Status, field: field}, oldEntry)
+		} else {
+			x.insert(orderKey{field: field}, entry)
+		}
+		x.insert(orderKey{status: expr.Status, field: field}, entry)
+	}
+	x.byID[expr.ID] = expr
+}
+
+// Reset заменяет содержимое индекса выражениями exprs.
+func (x *ExpressionIndex) Reset(exprs map[string]*models.Expression) {
+	x.mu.Lock()
+	x.byID = make(map[string]models.Expression, len(exprs))
+	x.orders = make(map[orderKey][]indexEntry)
+	x.mu.Unlock()
+	for _, expr := range exprs {
+		x.Put(*expr)
+	}
+}
+
+// Len возвращает число выражений в индексе.
+func (x *ExpressionIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.byID)
+}
+
+// search возвращает позицию первой записи списка, не меньшей entry.
+func search(list []indexEntry, entry indexEntry) int {
+	return sort.Search(len(list), func(i int) bool {
+		return !list[i].less(entry)
+	})
+}
+
+func (x *ExpressionIndex) insert(k orderKey, entry indexEntry) {
+	list := x.orders[k]
+	// Новые выражения почти всегда идут в конец списка.
+	if n := len(list); n == 0 || list[n-1].less(entry) {
+		x.orders[k] = append(list, entry)
+		return
+	}
+	i := search(list, entry)
+	list = append(list, indexEntry{})
+	copy(list[i+1:], list[i:])
+	list[i] = entry
+	x.orders[k] = list
+}
+
+func (x *ExpressionIndex) remove(k orderKey, entry indexEntry) {
+	list := x.orders[k]
+	if i := search(list, entry); i < len(list) && list[i] == entry {
+		x.orders[k] = append(list[:i], list[i+1:]...)
+	}
+}
+
+// sortKey возвращает значение поля сортировки; отсутствующее время
+// считается наименьшим.
+func sortKey(expr *models.Expression, field string) int64 {
+	timeKey := func(t *time.Time) int64 {
+		if t == nil {
+			return 0
+		}
+		return t.UnixNano()
+	}
+	switch field {
+	case "created_at":
+		return expr.CreatedAt.UnixNano()
+	case "started_at":
+		return timeKey(expr.StartedAt)
+	case "finished_at":
+		return timeKey(expr.FinishedAt)
+	case "priority":
+		return int64(expr.Priority)
+	default:
+		return 0
+	}
+}
+
+// listCursor — позиция последнего выданного выражения.
+type listCursor struct {
+	Sort string `json:"s"`
+	Key  int64  `json:"k"`
+	ID   string `json:"id"`
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrBadCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrBadCursor
+	}
+	return c, nil
+}
+
+// ParseSort проверяет параметр сортировки и возвращает поле и направление.
+func ParseSort(sortParam string) (field string, desc bool, err error) {
+	field = strings.TrimPrefix(sortParam, "-")
+	desc = field != sortParam
+	if field == "" {
+		return "created_at", desc, nil
+	}
+	for _, f := range SortFields {
+		if f == field {
+			return field, desc, nil
+		}
+	}
+	return "", false, fmt.Errorf("неизвестное поле сортировки: %q", field)
+}
+
+// Query возвращает страницу выражений, подходящих под фильтр q. Страница
+// берётся из готового упорядоченного списка с позиции курсора; весь список
+// просматривается, только если фильтр since сочетается с сортировкой не по
+// created_at.
+func (x *ExpressionIndex) Query(q ListQuery) (ListPage, error) {
+	field, desc, err := ParseSort(q.Sort)
+	if err != nil {
+		return ListPage{}, err
+	}
+	sortName := q.Sort
+	if sortName == "" {
+		sortName = field
+	}
+	var after *listCursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != sortName {
+			return ListPage{}, ErrBadCursor
+		}
+		after = &c
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	list := x.orders[orderKey{status: q.Status, field: field}]
+	// Для сортировки по времени создания фильтр since — это начало списка;
+	// для остальных полей выражения, созданные раньше, пропускаются.
+	lo := 0
+	if field == "created_at" && !q.Since.IsZero() {
+		lo = search(list, indexEntry{key: q.Since.UnixNano()})
+	}
+	matches := func(e indexEntry) bool {
+		return field == "created_at" || q.Since.IsZero() || !x.byID[e.id].CreatedAt.Before(q.Since)
+	}
+
+	page := ListPage{Expressions: make([]models.Expression, 0)}
+	if field == "created_at" || q.Since.IsZero() {
+		page.Total = len(list) - lo
+	} else {
+		for _, e := range list {
+			if matches(e) {
+				page.Total++
+			}
+		}
+	}
+
+	// Список обходится от курсора вперёд или, при сортировке по убыванию, назад.
+	pos, step := lo, 1
+	if desc {
+		pos, step = len(list)-1, -1
+	}
+	if after != nil {
+		cursor := indexEntry{key: after.Key, id: after.ID}
+		i := search(list, cursor)
+		switch {
+		case desc:
+			pos = i - 1
+		case i < len(list) && list[i] == cursor:
+			pos = i + 1
+		default:
+			pos = i
+		}
+		if pos < lo && !desc {
+			pos = lo
+		}
+	}
+	for ; pos >= lo && pos < len(list); pos += step {
+		e := list[pos]
+		if !matches(e) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Expressions) == q.Limit {
+			last := &page.Expressions[len(page.Expressions)-1]
+			page.NextCursor = encodeCursor(listCursor{Sort: sortName, Key: sortKey(last, field), ID: last.ID})
+			break
+		}
+		page.Expressions = append(page.Expressions, x.byID[e.id])
+	}
+	return page, nil
+}
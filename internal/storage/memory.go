@@ -8,9 +8,13 @@ import (
 )
 
 // MemoryStore реализует простое in-memory хранилище для выражений.
+// В надёжном режиме (см. OpenDurable) каждое изменение также записывается
+// в журнал на диске.
 type MemoryStore struct {
 	Expressions map[string]*models.Expression
 	Mutex       sync.Mutex
+
+	durable *durableState
 }
 
 // NewMemoryStore возвращает новый экземпляр хранилища.
@@ -20,11 +24,33 @@ func NewMemoryStore() *MemoryStore {
 	}
 }
 
-// SaveExpression сохраняет выражение в хранилище.
-func (s *MemoryStore) SaveExpression(id string, expr *models.Expression) {
+// SaveExpression сохраняет выражение в хранилище. В надёжном режиме метод
+// возвращает управление только после того, как запись попала на диск;
+// последующие изменения выражения нужно сохранять повторным вызовом.
+func (s *MemoryStore) SaveExpression(id string, expr *models.Expression) error {
+	if s.durable != nil {
+		copied := *expr
+		copied.ID = id
+		return s.saveDurable([]*models.Expression{&copied})
+	}
 	s.Mutex.Lock()
 	defer s.Mutex.Unlock()
 	s.Expressions[id] = expr
+	return nil
+}
+
+// SaveExpressions сохраняет несколько выражений под их ID. В надёжном
+// режиме все записи сбрасываются на диск одним fsync.
+func (s *MemoryStore) SaveExpressions(exprs []*models.Expression) error {
+	if s.durable != nil {
+		return s.saveDurable(exprs)
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for _, expr := range exprs {
+		s.Expressions[expr.ID] = expr
+	}
+	return nil
 }
 
 // GetExpression возвращает выражение по его ID.
@@ -34,3 +60,12 @@ func (s *MemoryStore) GetExpression(id string) (*models.Expression, bool) {
 	expr, exists := s.Expressions[id]
 	return expr, exists
 }
+
+// Close сбрасывает журнал на диск и закрывает его. Для хранилища в памяти
+// ничего не делает.
+func (s *MemoryStore) Close() error {
+	if s.durable == nil {
+		return nil
+	}
+	return s.durable.wal.close()
+}
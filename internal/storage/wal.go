@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// walHeaderSize — длина заголовка записи журнала: длина данных и их
+// контрольная сумма CRC-32C, по 4 байта в порядке little-endian.
+const walHeaderSize = 8
+
+// maxWALRecord ограничивает длину записи, чтобы повреждённый заголовок не
+// приводил к попытке прочитать гигабайты.
+const maxWALRecord = 16 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord означает, что запись журнала оборвана или повреждена.
+var errTornRecord = errors.New("запись журнала повреждена")
+
+// wal — журнал упреждающей записи. Записи дописываются в буфер, а на диск
+// сбрасываются группами: первый ожидающий запускает fsync, покрывающий все
+// записи, добавленные к этому моменту, остальные ждут его завершения.
+type wal struct {
+	file *os.File
+	buf  *bufio.Writer
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written uint64 // номер последней записи в буфере
+	synced  uint64 // номер последней записи на диске
+	syncing bool
+	err     error
+}
+
+func openWAL(path string) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &wal{file: file}
+	w.cond = sync.NewCond(&w.mu)
+	return w, nil
+}
+
+// readAll читает записи журнала с начала. Файл усекается до последней
+// целой записи, только если после неё осталось меньше байт, чем занимает
+// заголовок или заявленная в нём запись, либо последняя запись повреждена.
+// Повреждённая запись, за которой в файле есть ещё данные, и заголовок с
+// недопустимой длиной не в конце файла — это не оборванная запись, а порча
+// журнала: тогда возвращается ошибка, а файл не меняется.
+func (w *wal) readAll(apply func(payload []byte) error) error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(w.file)
+	var offset int64
+	for {
+		payload, size, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errTornRecord) {
+			remaining := info.Size() - offset
+			if size-walHeaderSize > maxWALRecord && remaining > walHeaderSize {
+				return fmt.Errorf("%w: смещение %d, недопустимая длина записи %d", err, offset, size-walHeaderSize)
+			}
+			if size > 0 && size < remaining {
+				return fmt.Errorf("%w: смещение %d, за ней ещё %d байт", err, offset, remaining-size)
+			}
+			if err := w.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := apply(payload); err != nil {
+			return err
+		}
+		offset += size
+	}
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	w.buf = bufio.NewWriter(w.file)
+	return nil
+}
+
+// readRecord читает одну запись и возвращает её данные и длину вместе с
+// заголовком. Для повреждённой записи длина берётся из заголовка, если он
+// прочитан целиком.
+func readRecord(r *bufio.Reader) ([]byte, int64, error) {
+	var header [walHeaderSize]byte
+	n, err := io.ReadFull(r, header[:])
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF || (err == nil && n < walHeaderSize) {
+		return nil, 0, errTornRecord
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	size := int64(walHeaderSize) + int64(length)
+	if length > maxWALRecord {
+		return nil, size, errTornRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, size, errTornRecord
+	} else if err != nil {
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != sum {
+		return nil, size, errTornRecord
+	}
+	return payload, size, nil
+}
+
+// append добавляет запись в буфер и возвращает её номер для sync.
+func (w *wal) append(payload []byte) (uint64, error) {
+	var header [walHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	if _, err := w.buf.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.buf.Write(payload); err != nil {
+		return 0, err
+	}
+	w.written++
+	return w.written, nil
+}
+
+// sync ждёт, пока запись с номером seq окажется на диске.
+func (w *wal) sync(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.synced < seq && w.err == nil {
+		if w.syncing {
+			w.cond.Wait()
+			continue
+		}
+		w.syncing = true
+		target := w.written
+		err := w.buf.Flush()
+		w.mu.Unlock()
+		if err == nil {
+			err = w.file.Sync()
+		}
+		w.mu.Lock()
+		w.syncing = false
+		if err != nil {
+			w.err = err
+		} else {
+			w.synced = target
+		}
+		w.cond.Broadcast()
+	}
+	return w.err
+}
+
+// reset очищает журнал после того, как его записи вошли в снимок.
+// Вызывается, когда новых записей не добавляется.
+func (w *wal) reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.syncing {
+		w.cond.Wait()
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.synced = w.written
+	w.buf.Reset(w.file)
+	w.cond.Broadcast()
+	return nil
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	for w.syncing {
+		w.cond.Wait()
+	}
+	err := w.buf.Flush()
+	w.mu.Unlock()
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
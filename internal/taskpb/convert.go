@@ -0,0 +1,101 @@
+package taskpb
+
+import (
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+)
+
+// FromTask преобразует задачу в protobuf-сообщение.
+func FromTask(task *models.Task) *Task {
+	msg := &Task{
+		Id:                 task.ID,
+		ExpressionId:       task.ExpressionID,
+		Arg1:               task.Arg1,
+		Arg2:               task.Arg2,
+		Operation:          task.Operation,
+		OperationTime:      int32(task.OperationTime),
+		Priority:           int32(task.Priority),
+		ExpressionPriority: int32(task.ExpressionPriority),
+	}
+	if task.Deadline != nil {
+		msg.DeadlineUnixNano = task.Deadline.UnixNano()
+	}
+	msg.Subtree = fromTaskNode(task.Subtree)
+	return msg
+}
+
+func fromTaskNode(node *models.TaskNode) *TaskNode {
+	if node == nil {
+		return nil
+	}
+	return &TaskNode{
+		Id:            node.ID,
+		Operation:     node.Operation,
+		OperationTime: int32(node.OperationTime),
+		Value:         node.Value,
+		Left:          fromTaskNode(node.Left),
+		Right:         fromTaskNode(node.Right),
+	}
+}
+
+// ToModel преобразует protobuf-сообщение в узел поддерева.
+func (x *TaskNode) ToModel() *models.TaskNode {
+	if x == nil {
+		return nil
+	}
+	return &models.TaskNode{
+		ID:            x.GetId(),
+		Operation:     x.GetOperation(),
+		OperationTime: int(x.GetOperationTime()),
+		Value:         x.GetValue(),
+		Left:          x.GetLeft().ToModel(),
+		Right:         x.GetRight().ToModel(),
+	}
+}
+
+// ToModel преобразует protobuf-сообщение в задачу.
+func (x *Task) ToModel() *models.Task {
+	task := &models.Task{
+		ID:                 x.GetId(),
+		ExpressionID:       x.GetExpressionId(),
+		Arg1:               x.GetArg1(),
+		Arg2:               x.GetArg2(),
+		Operation:          x.GetOperation(),
+		OperationTime:      int(x.GetOperationTime()),
+		Priority:           int(x.GetPriority()),
+		ExpressionPriority: int(x.GetExpressionPriority()),
+	}
+	if nanos := x.GetDeadlineUnixNano(); nanos != 0 {
+		deadline := time.Unix(0, nanos)
+		task.Deadline = &deadline
+	}
+	task.Subtree = x.GetSubtree().ToModel()
+	return task
+}
+
+// FromResult преобразует результат задачи в protobuf-сообщение.
+func FromResult(res models.Result) *Result {
+	msg := &Result{Id: res.ID, Result: res.Result, Error: res.Error}
+	for _, timing := range res.Timings {
+		msg.Timings = append(msg.Timings, &NodeTiming{
+			Id:            timing.ID,
+			Result:        timing.Result,
+			DurationNanos: int64(timing.Duration),
+		})
+	}
+	return msg
+}
+
+// ToModel преобразует protobuf-сообщение в результат задачи.
+func (x *Result) ToModel() models.Result {
+	res := models.Result{ID: x.GetId(), Result: x.GetResult(), Error: x.GetError()}
+	for _, timing := range x.GetTimings() {
+		res.Timings = append(res.Timings, models.NodeTiming{
+			ID:       timing.GetId(),
+			Result:   timing.GetResult(),
+			Duration: time.Duration(timing.GetDurationNanos()),
+		})
+	}
+	return res
+}
@@ -0,0 +1,5 @@
+// Package taskpb содержит protobuf-описание протокола обмена задачами между
+// агентом и оркестратором и сгенерированный по нему код gRPC.
+package taskpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative task.proto
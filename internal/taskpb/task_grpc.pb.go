@@ -0,0 +1,213 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: task.proto
+
+package taskpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TaskService_FetchTasks_FullMethodName    = "/calculator.task.v1.TaskService/FetchTasks"
+	TaskService_SubmitResults_FullMethodName = "/calculator.task.v1.TaskService/SubmitResults"
+)
+
+// TaskServiceClient is the client API for TaskService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TaskServiceClient interface {
+	// FetchTasks отправляет агенту задачи по мере их готовности, удерживая не
+	// более capacity задач без результата. При закрытии потока невыполненные
+	// задачи возвращаются в очередь.
+	FetchTasks(ctx context.Context, in *FetchTasksRequest, opts ...grpc.CallOption) (TaskService_FetchTasksClient, error)
+	// SubmitResults принимает поток результатов и подтверждает каждый из них.
+	SubmitResults(ctx context.Context, opts ...grpc.CallOption) (TaskService_SubmitResultsClient, error)
+}
+
+type taskServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTaskServiceClient(cc grpc.ClientConnInterface) TaskServiceClient {
+	return &taskServiceClient{cc}
+}
+
+func (c *taskServiceClient) FetchTasks(ctx context.Context, in *FetchTasksRequest, opts ...grpc.CallOption) (TaskService_FetchTasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TaskService_ServiceDesc.Streams[0], TaskService_FetchTasks_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &taskServiceFetchTasksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TaskService_FetchTasksClient interface {
+	Recv() (*Task, error)
+	grpc.ClientStream
+}
+
+type taskServiceFetchTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *taskServiceFetchTasksClient) Recv() (*Task, error) {
+	m := new(Task)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *taskServiceClient) SubmitResults(ctx context.Context, opts ...grpc.CallOption) (TaskService_SubmitResultsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TaskService_ServiceDesc.Streams[1], TaskService_SubmitResults_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &taskServiceSubmitResultsClient{stream}
+	return x, nil
+}
+
+type TaskService_SubmitResultsClient interface {
+	Send(*Result) error
+	Recv() (*ResultAck, error)
+	grpc.ClientStream
+}
+
+type taskServiceSubmitResultsClient struct {
+	grpc.ClientStream
+}
+
+func (x *taskServiceSubmitResultsClient) Send(m *Result) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *taskServiceSubmitResultsClient) Recv() (*ResultAck, error) {
+	m := new(ResultAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TaskServiceServer is the server API for TaskService service.
+// All implementations must embed UnimplementedTaskServiceServer
+// for forward compatibility
+type TaskServiceServer interface {
+	// FetchTasks отправляет агенту задачи по мере их готовности, удерживая не
+	// более capacity задач без результата. При закрытии потока невыполненные
+	// задачи возвращаются в очередь.
+	FetchTasks(*FetchTasksRequest, TaskService_FetchTasksServer) error
+	// SubmitResults принимает поток результатов и подтверждает каждый из них.
+	SubmitResults(TaskService_SubmitResultsServer) error
+	mustEmbedUnimplementedTaskServiceServer()
+}
+
+// UnimplementedTaskServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTaskServiceServer struct {
+}
+
+func (UnimplementedTaskServiceServer) FetchTasks(*FetchTasksRequest, TaskService_FetchTasksServer) error {
+	return status.Errorf(codes.Unimplemented, "method FetchTasks not implemented")
+}
+func (UnimplementedTaskServiceServer) SubmitResults(TaskService_SubmitResultsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitResults not implemented")
+}
+func (UnimplementedTaskServiceServer) mustEmbedUnimplementedTaskServiceServer() {}
+
+// UnsafeTaskServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TaskServiceServer will
+// result in compilation errors.
+type UnsafeTaskServiceServer interface {
+	mustEmbedUnimplementedTaskServiceServer()
+}
+
+func RegisterTaskServiceServer(s grpc.ServiceRegistrar, srv TaskServiceServer) {
+	s.RegisterService(&TaskService_ServiceDesc, srv)
+}
+
+func _TaskService_FetchTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchTasksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TaskServiceServer).FetchTasks(m, &taskServiceFetchTasksServer{stream})
+}
+
+type TaskService_FetchTasksServer interface {
+	Send(*Task) error
+	grpc.ServerStream
+}
+
+type taskServiceFetchTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *taskServiceFetchTasksServer) Send(m *Task) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TaskService_SubmitResults_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TaskServiceServer).SubmitResults(&taskServiceSubmitResultsServer{stream})
+}
+
+type TaskService_SubmitResultsServer interface {
+	Send(*ResultAck) error
+	Recv() (*Result, error)
+	grpc.ServerStream
+}
+
+type taskServiceSubmitResultsServer struct {
+	grpc.ServerStream
+}
+
+func (x *taskServiceSubmitResultsServer) Send(m *ResultAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *taskServiceSubmitResultsServer) Recv() (*Result, error) {
+	m := new(Result)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TaskService_ServiceDesc is the grpc.ServiceDesc for TaskService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TaskService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "calculator.task.v1.TaskService",
+	HandlerType: (*TaskServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "FetchTasks",
+			Handler:       _TaskService_FetchTasks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubmitResults",
+			Handler:       _TaskService_SubmitResults_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "task.proto",
+}
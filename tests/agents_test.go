@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func postJSON(t testing.TB, url string, body interface{}, header http.Header) *http.Response {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе %s: %v", url, err)
+	}
+	return resp
+}
+
+func listAgents(t *testing.T, url string) []models.Agent {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе списка агентов: %v", err)
+	}
+	defer resp.Body.Close()
+	var res map[string][]models.Agent
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("Не удалось декодировать список агентов: %v", err)
+	}
+	return res["agents"]
+}
+
+func TestAgentRegistrationAndStats(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	info := models.AgentInfo{ID: "agent-1", Hostname: "worker-host", ComputingPower: 4, Version: "1.0"}
+	resp := postJSON(t, ts.URL+"/internal/agents/register", info, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус OK при регистрации, получен %d", resp.StatusCode)
+	}
+
+	resp = postJSON(t, ts.URL+"/internal/agents/heartbeat", map[string]string{"id": "unknown"}, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для пульса незарегистрированного агента, получен %d", resp.StatusCode)
+	}
+
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "1/0"})
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2"})
+
+	header := http.Header{models.AgentIDHeader: {"agent-1"}}
+	var tasks []models.Task
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/internal/task", nil)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Ошибка при запросе задачи: %v", err)
+		}
+		var taskRes map[string]models.Task
+		json.NewDecoder(resp.Body).Decode(&taskRes)
+		resp.Body.Close()
+		tasks = append(tasks, taskRes["task"])
+	}
+
+	agents := listAgents(t, ts.URL+"/internal/agents")
+	if len(agents) != 1 || agents[0].TasksInFlight != 2 || agents[0].ComputingPower != 4 {
+		t.Fatalf("Ожидался 1 агент с 2 задачами в работе, получено %+v", agents)
+	}
+
+	for _, task := range tasks {
+		res := models.Result{ID: task.ID, Result: task.Arg1 + task.Arg2}
+		if task.Operation == "/" {
+			res = models.Result{ID: task.ID, Error: "деление на ноль"}
+		}
+		postJSON(t, ts.URL+"/internal/task/result", res, header).Body.Close()
+	}
+
+	agents = listAgents(t, ts.URL+"/api/v1/admin/agents")
+	if len(agents) != 1 {
+		t.Fatalf("Ожидался 1 агент, получено %d", len(agents))
+	}
+	agent := agents[0]
+	if agent.TasksInFlight != 0 || agent.Completed != 1 || agent.Errors != 1 || agent.ErrorRate != 0.5 {
+		t.Errorf("Неверная статистика агента: %+v", agent)
+	}
+	if agent.Status != models.AgentAlive || agent.Hostname != "worker-host" {
+		t.Errorf("Неверные сведения об агенте: %+v", agent)
+	}
+}
+
+func TestDeadAgentTasksRequeued(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.HeartbeatTimeout = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.RunWatchdog(ctx, 10*time.Millisecond)
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: "agent-1", ComputingPower: 1}, nil).Body.Close()
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "3*3"})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/internal/task", nil)
+	req.Header.Set(models.AgentIDHeader, "agent-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	var taskRes map[string]models.Task
+	json.NewDecoder(resp.Body).Decode(&taskRes)
+	resp.Body.Close()
+
+	time.Sleep(150 * time.Millisecond)
+
+	agents := listAgents(t, ts.URL+"/internal/agents")
+	if len(agents) != 1 || agents[0].Status != models.AgentDead || agents[0].TasksInFlight != 0 {
+		t.Fatalf("Ожидался недоступный агент без задач, получено %+v", agents)
+	}
+
+	resp, err = http.Get(ts.URL + "/internal/task")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	defer resp.Body.Close()
+	var requeued map[string]models.Task
+	json.NewDecoder(resp.Body).Decode(&requeued)
+	if resp.StatusCode != http.StatusOK || requeued["task"].ID != taskRes["task"].ID {
+		t.Errorf("Ожидался возврат задачи %s в очередь, получен статус %d", taskRes["task"].ID, resp.StatusCode)
+	}
+
+	resp = postJSON(t, ts.URL+"/internal/agents/heartbeat", map[string]string{"id": "agent-1"}, nil)
+	resp.Body.Close()
+	if agents := listAgents(t, ts.URL+"/internal/agents"); agents[0].Status != models.AgentAlive {
+		t.Errorf("Ожидалось восстановление агента после пульса, статус %s", agents[0].Status)
+	}
+}
+
+func TestCapabilityBasedRouting(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: "divider", ComputingPower: 1, Operations: []string{"/"}}, nil).Body.Close()
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)+(3+4)"})
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "8/2"})
+
+	fetch := func(query string, agentID string) (int, models.Task) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/internal/task"+query, nil)
+		if agentID != "" {
+			req.Header.Set(models.AgentIDHeader, agentID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Ошибка при запросе задачи: %v", err)
+		}
+		defer resp.Body.Close()
+		var taskRes map[string]models.Task
+		json.NewDecoder(resp.Body).Decode(&taskRes)
+		return resp.StatusCode, taskRes["task"]
+	}
+
+	if status, task := fetch("", "divider"); status != http.StatusOK || task.Operation != "/" {
+		t.Fatalf("Агент деления должен получить задачу '/', получен статус %d и задача %+v", status, task)
+	}
+	if status, _ := fetch("", "divider"); status != http.StatusNotFound {
+		t.Errorf("Для агента деления не должно остаться задач, получен статус %d", status)
+	}
+	if status, task := fetch("?ops="+url.QueryEscape("+,-"), ""); status != http.StatusOK || task.Operation != "+" {
+		t.Errorf("Агент сложения должен получить задачу '+', получен статус %d и задача %+v", status, task)
+	}
+	if status, _ := fetch("?ops=*", ""); status != http.StatusNotFound {
+		t.Errorf("Для агента умножения не должно быть задач, получен статус %d", status)
+	}
+}
+
+func TestReapedStreamAgentTaskComputedOnce(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.HeartbeatTimeout = 50 * time.Millisecond
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: "stream-dead", ComputingPower: 1}, nil).Body.Close()
+	conn, err := agent.DialStream(ts.URL, "stream-dead", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось открыть поток задач: %v", err)
+	}
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "3*3"})
+	task := recvTask(t, conn, time.Second)
+
+	// Агент перестал присылать пульс: задача возвращается в очередь и
+	// выдаётся другому агенту.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.RunWatchdog(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Report().QueuedTasks == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if requeued := fetchTask(t, ts.URL); requeued.ID != task.ID {
+		t.Fatalf("Ожидалась возвращённая задача %s, получена %+v", task.ID, requeued)
+	}
+
+	// Разрыв потока умершего агента не должен возвращать задачу, уже выданную заново.
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if report := server.Report(); report.QueuedTasks != 0 || report.DispatchedTasks != 1 {
+		t.Errorf("Задача возвращена в очередь повторно: %+v", report)
+	}
+}
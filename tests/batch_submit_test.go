@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+type batchItem struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+func submitBatch(t *testing.T, baseURL string, items ...map[string]interface{}) (string, []batchItem, int) {
+	t.Helper()
+	resp := postJSON(t, baseURL+"/api/v1/calculate/batch", map[string]interface{}{"expressions": items}, nil)
+	defer resp.Body.Close()
+	var res struct {
+		BatchID string      `json:"batch_id"`
+		Items   []batchItem `json:"items"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res.BatchID, res.Items, resp.StatusCode
+}
+
+func getBatch(t *testing.T, baseURL, id string) (models.BatchProgress, int) {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/batches/" + id)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе пакета: %v", err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Batch models.BatchProgress `json:"batch"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res.Batch, resp.StatusCode
+}
+
+func TestBatchSubmitReportsItemsSeparately(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	batchID, items, status := submitBatch(t, ts.URL,
+		map[string]interface{}{"expression": "2+3*4"},
+		map[string]interface{}{"expression": "1+"},
+		map[string]interface{}{"expression": "x*y-1", "variables": map[string]float64{"x": 3, "y": 5}, "priority": 5},
+		map[string]interface{}{"expression": "z+1"},
+	)
+	if status != http.StatusCreated || batchID == "" || len(items) != 4 {
+		t.Fatalf("Ожидался принятый пакет из 4 элементов, получено %q %+v (статус %d)", batchID, items, status)
+	}
+	for i, item := range items {
+		wantErr := i == 1 || i == 3
+		if item.Index != i || (item.Error != "") != wantErr || (item.ID == "") != wantErr {
+			t.Errorf("Неверный итог элемента %d: %+v", i, item)
+		}
+	}
+	if expr := getExpression(t, ts.URL, items[2].ID); expr.Priority != 5 || expr.BatchID != batchID || expr.Variables["x"] != 3 {
+		t.Errorf("Параметры элемента пакета не сохранены: %+v", expr)
+	}
+
+	progress, status := getBatch(t, ts.URL, batchID)
+	if status != http.StatusOK || progress.Total != 2 || progress.Finished ||
+		progress.Statuses[models.StatusPending] != 2 || progress.TotalNodes != 4 || progress.ComputedNodes != 0 {
+		t.Fatalf("Неверный ход пакета до вычисления: %+v (статус %d)", progress, status)
+	}
+
+	drainTasks(t, ts.URL)
+	progress, _ = getBatch(t, ts.URL, batchID)
+	if !progress.Finished || progress.Statuses[models.StatusCompleted] != 2 || progress.ComputedNodes != 4 {
+		t.Errorf("Неверный ход пакета после вычисления: %+v", progress)
+	}
+	if expr := getExpression(t, ts.URL, items[0].ID); *expr.Result != 14 {
+		t.Errorf("Ожидался результат 14, получено %+v", expr)
+	}
+	if expr := getExpression(t, ts.URL, items[2].ID); *expr.Result != 14 {
+		t.Errorf("Ожидался результат 14 для выражения с переменными, получено %+v", expr)
+	}
+}
+
+func TestBatchSubmitRejectsInvalidBatches(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	if _, items, status := submitBatch(t, ts.URL, map[string]interface{}{"expression": "(1"}); status != http.StatusUnprocessableEntity || len(items) != 1 || items[0].Error == "" {
+		t.Errorf("Ожидался статус 422 для пакета без верных выражений, получено %+v (статус %d)", items, status)
+	}
+	if _, _, status := submitBatch(t, ts.URL); status != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался статус 422 для пустого пакета, получен %d", status)
+	}
+	if _, status := getBatch(t, ts.URL, "batch-unknown"); status != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для неизвестного пакета, получен %d", status)
+	}
+	if exprs := listExpressions(t, ts.URL); len(exprs) != 0 {
+		t.Errorf("Отклонённые выражения не должны сохраняться: %+v", exprs)
+	}
+}
+
+func TestBatchSurvivesRestore(t *testing.T) {
+	path := t.TempDir() + "/events.log"
+	server := orchestrator.NewServer()
+	if err := server.OpenEventLog(path); err != nil {
+		t.Fatalf("Не удалось открыть журнал: %v", err)
+	}
+	ts := httptest.NewServer(server.Router)
+	batchID, _, _ := submitBatch(t, ts.URL,
+		map[string]interface{}{"expression": "a+b", "variables": map[string]float64{"a": 1, "b": 2}},
+		map[string]interface{}{"expression": "7-2"},
+	)
+	ts.Close()
+	server.Events.Close()
+
+	restored := orchestrator.NewServer()
+	if err := restored.OpenEventLog(path); err != nil {
+		t.Fatalf("Не удалось восстановить состояние: %v", err)
+	}
+	defer restored.Events.Close()
+	ts = httptest.NewServer(restored.Router)
+	defer ts.Close()
+
+	if progress, status := getBatch(t, ts.URL, batchID); status != http.StatusOK || progress.Total != 2 {
+		t.Fatalf("Пакет не восстановлен из журнала: %+v (статус %d)", progress, status)
+	}
+	drainTasks(t, ts.URL)
+	if progress, _ := getBatch(t, ts.URL, batchID); !progress.Finished || progress.Statuses[models.StatusCompleted] != 2 {
+		t.Errorf("Восстановленный пакет не вычислен: %+v", progress)
+	}
+}
+
+func TestBatchSubmitAssignsUniqueIDs(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	items := make([]map[string]interface{}, 1000)
+	for i := range items {
+		items[i] = map[string]interface{}{"expression": "1+2"}
+	}
+	ids := make(map[string]bool)
+	batches := make(map[string]bool)
+	for round := 0; round < 3; round++ {
+		batchID, res, status := submitBatch(t, ts.URL, items...)
+		if status != http.StatusCreated || len(res) != len(items) || batches[batchID] {
+			t.Fatalf("Неверный итог пакета %q: %d элементов (статус %d)", batchID, len(res), status)
+		}
+		batches[batchID] = true
+		for _, item := range res {
+			if item.ID == "" || ids[item.ID] {
+				t.Fatalf("ID выражения пуст или повторяется: %+v", item)
+			}
+			ids[item.ID] = true
+		}
+		if progress, _ := getBatch(t, ts.URL, batchID); progress.Total != len(items) {
+			t.Errorf("Ожидалось %d выражений в пакете, получено %+v", len(items), progress)
+		}
+	}
+}
+
+func TestBatchWithoutOperationsFinishes(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	batchID, items, status := submitBatch(t, ts.URL,
+		map[string]interface{}{"expression": "7"},
+		map[string]interface{}{"expression": "y", "variables": map[string]float64{"y": 2}},
+	)
+	if status != http.StatusCreated || len(items) != 2 {
+		t.Fatalf("Ожидался принятый пакет из 2 элементов, получено %+v (статус %d)", items, status)
+	}
+	if progress, _ := getBatch(t, ts.URL, batchID); !progress.Finished || progress.Statuses[models.StatusCompleted] != 2 {
+		t.Errorf("Пакет выражений без операций должен быть завершён сразу: %+v", progress)
+	}
+	if expr := getExpression(t, ts.URL, items[1].ID); expr.Result == nil || *expr.Result != 2 {
+		t.Errorf("Ожидался результат 2, получено %+v", expr)
+	}
+}
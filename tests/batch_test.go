@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// fetchTasks запрашивает пакет задач и возвращает их вместе со статусом ответа.
+func fetchTasks(tb testing.TB, baseURL string, limit int) ([]models.Task, int) {
+	tb.Helper()
+	resp, err := http.Get(fmt.Sprintf("%s/internal/task?limit=%d", baseURL, limit))
+	if err != nil {
+		tb.Fatalf("Ошибка при запросе пакета задач: %v", err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			tb.Fatalf("Не удалось декодировать пакет задач: %v", err)
+		}
+	}
+	return res.Tasks, resp.StatusCode
+}
+
+func TestBatchFetchAndResults(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	ids := []string{
+		submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+2"}),
+		submitExpression(t, ts.URL, map[string]interface{}{"expression": "3*4"}),
+		submitExpression(t, ts.URL, map[string]interface{}{"expression": "5/0"}),
+	}
+
+	tasks, status := fetchTasks(t, ts.URL, 2)
+	if status != http.StatusOK || len(tasks) != 2 {
+		t.Fatalf("Ожидалось 2 задачи при limit=2, получено %d (статус %d)", len(tasks), status)
+	}
+	more, _ := fetchTasks(t, ts.URL, 10)
+	tasks = append(tasks, more...)
+	if len(tasks) != 3 {
+		t.Fatalf("Ожидалось 3 задачи всего, получено %d", len(tasks))
+	}
+	if _, status := fetchTasks(t, ts.URL, 10); status != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для пустой очереди, получен %d", status)
+	}
+
+	var results []models.Result
+	for _, task := range tasks {
+		switch task.Operation {
+		case "+":
+			results = append(results, models.Result{ID: task.ID, Result: task.Arg1 + task.Arg2})
+		case "*":
+			results = append(results, models.Result{ID: task.ID, Result: task.Arg1 * task.Arg2})
+		default:
+			results = append(results, models.Result{ID: task.ID, Error: "деление на ноль"})
+		}
+	}
+	results = append(results, models.Result{ID: "unknown-1", Result: 1})
+
+	resp := postJSON(t, ts.URL+"/internal/task/results", map[string]interface{}{"results": results}, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус OK для пакета результатов, получен %d", resp.StatusCode)
+	}
+	var ackRes struct {
+		Results []models.ResultAck `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ackRes); err != nil {
+		t.Fatalf("Не удалось декодировать подтверждения: %v", err)
+	}
+	if len(ackRes.Results) != len(results) {
+		t.Fatalf("Ожидалось %d подтверждений, получено %d", len(results), len(ackRes.Results))
+	}
+	for i, ack := range ackRes.Results {
+		want := http.StatusOK
+		if results[i].Error != "" {
+			want = http.StatusUnprocessableEntity
+		} else if results[i].ID == "unknown-1" {
+			want = http.StatusNotFound
+		}
+		if ack.ID != results[i].ID || ack.Status != want {
+			t.Errorf("Неверное подтверждение для %s: %+v, ожидался статус %d", results[i].ID, ack, want)
+		}
+	}
+
+	for i, want := range []models.ExpressionStatus{models.StatusCompleted, models.StatusCompleted, models.StatusError} {
+		if expr := getExpression(t, ts.URL, ids[i]); expr.Status != want {
+			t.Errorf("Выражение %s: ожидался статус %s, получен %s", ids[i], want, expr.Status)
+		}
+	}
+}
+
+// exchangeTasks забирает задачи (по одной при batch == 1, иначе пакетом) и
+// сразу возвращает их результаты. Возвращает false, когда задач не осталось.
+// Ошибки возвращаются, а не передаются в testing.TB, поэтому функцию можно
+// вызывать из любой горутины.
+func exchangeTasks(baseURL string, batch int) (bool, error) {
+	url := baseURL + "/internal/task"
+	if batch > 1 {
+		url = fmt.Sprintf("%s?limit=%d", url, batch)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("статус %d при запросе задач", resp.StatusCode)
+	}
+	var res struct {
+		Task  *models.Task  `json:"task"`
+		Tasks []models.Task `json:"tasks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, err
+	}
+
+	var body interface{}
+	resultURL := baseURL + "/internal/task/results"
+	if res.Task != nil {
+		body = models.Result{ID: res.Task.ID, Result: 2}
+		resultURL = baseURL + "/internal/task/result"
+	} else {
+		results := make([]models.Result, len(res.Tasks))
+		for i, task := range res.Tasks {
+			results[i] = models.Result{ID: task.ID, Result: 2}
+		}
+		body = map[string]interface{}{"results": results}
+	}
+	data, _ := json.Marshal(body)
+	resp, err = http.Post(resultURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("статус %d при отправке результатов", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// BenchmarkResultThroughput сравнивает обработку задач по одной и пакетами:
+// workers горутин забирают задачи и сразу возвращают результаты, так что
+// время определяется накладными расходами HTTP и блокировкой оркестратора.
+func BenchmarkResultThroughput(b *testing.B) {
+	const workers = 8
+	for _, batch := range []int{1, 32} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			server := orchestrator.NewServer()
+			ts := httptest.NewServer(server.Router)
+			defer ts.Close()
+			for i := 0; i < b.N; i++ {
+				submitExpression(b, ts.URL, map[string]interface{}{"expression": "1+1"})
+			}
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			errs := make(chan error, workers)
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						more, err := exchangeTasks(ts.URL, batch)
+						if err != nil {
+							errs <- err
+							return
+						}
+						if !more {
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				b.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+type syncResponse struct {
+	ID         string             `json:"id"`
+	Expression *models.Expression `json:"expression"`
+}
+
+func calculateAndWait(t *testing.T, baseURL, wait, expression string) (syncResponse, int) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]string{"expression": expression})
+	resp, err := http.Post(baseURL+"/api/v1/calculate?wait="+wait, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+	}
+	defer resp.Body.Close()
+	var body syncResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body, resp.StatusCode
+}
+
+func TestCalculateWaitReturnsResult(t *testing.T) {
+	t.Setenv("TIME_ADDITION_MS", "10")
+	t.Setenv("TIME_MULTIPLICATIONS_MS", "10")
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := agent.StartWorkers(ctx, 2, agent.NewHTTPTransport(ts.URL, "sync-agent", nil, time.Second))
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	body, status := calculateAndWait(t, ts.URL, "5s", "(1+2)*(3+4)")
+	if status != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен %d", status)
+	}
+	if body.Expression == nil || body.Expression.ID != body.ID || body.Expression.Status != models.StatusCompleted ||
+		body.Expression.Result == nil || *body.Expression.Result != 21 {
+		t.Errorf("Неверный результат синхронного вычисления: %+v", body.Expression)
+	}
+}
+
+func TestCalculateWaitTimesOut(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+
+	start := time.Now()
+	body, status := calculateAndWait(t, ts.URL, "50ms", "1+2")
+	if status != http.StatusAccepted || body.ID == "" || body.Expression != nil {
+		t.Fatalf("Ожидался статус 202 с ID выражения, получен %d %+v", status, body)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Ответ получен раньше окончания ожидания: %s", elapsed)
+	}
+	if expr := getExpression(t, ts.URL, body.ID); expr.Status != models.StatusPending {
+		t.Errorf("Выражение должно продолжать вычисляться, статус %s", expr.Status)
+	}
+
+	if _, status := calculateAndWait(t, ts.URL, "скоро", "1+2"); status != http.StatusBadRequest {
+		t.Errorf("Ожидался статус 400 для неверного wait, получен %d", status)
+	}
+}
+
+func TestCalculateWithoutOperationsCompletes(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+
+	body, status := calculateAndWait(t, ts.URL, "1s", "5")
+	if status != http.StatusOK || body.Expression == nil || body.Expression.Status != models.StatusCompleted ||
+		body.Expression.Result == nil || *body.Expression.Result != 5 || body.Expression.TotalNodes != 0 {
+		t.Fatalf("Число должно вычисляться сразу, получено %+v (статус %d)", body.Expression, status)
+	}
+
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "x", "variables": map[string]float64{"x": 3}})
+	if expr := getExpression(t, ts.URL, id); expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != 3 {
+		t.Errorf("Переменная должна вычисляться сразу, получено %+v", expr)
+	}
+}
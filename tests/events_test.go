@@ -0,0 +1,245 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func getEvents(t *testing.T, baseURL, id string) ([]models.Event, int) {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/expressions/" + id + "/events")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе событий: %v", err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Events []models.Event `json:"events"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res.Events, resp.StatusCode
+}
+
+func TestExpressionEvents(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*3"})
+	header := http.Header{models.AgentIDHeader: {"events-agent"}}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/internal/task", nil)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Ошибка при запросе задачи: %v", err)
+		}
+		var taskRes map[string]models.Task
+		json.NewDecoder(resp.Body).Decode(&taskRes)
+		resp.Body.Close()
+		postJSON(t, ts.URL+"/internal/task/result", computeResult(taskRes["task"]), header).Body.Close()
+	}
+
+	events, status := getEvents(t, ts.URL, exprID)
+	if status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK, получен %d", status)
+	}
+	want := []string{
+		models.EventSubmitted,
+		models.EventTaskScheduled, models.EventTaskDispatched, models.EventResultReceived,
+		models.EventTaskScheduled, models.EventTaskDispatched, models.EventResultReceived,
+		models.EventCompleted,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Ожидалось %d событий, получено %d: %+v", len(want), len(events), events)
+	}
+	for i, ev := range events {
+		if ev.Type != want[i] {
+			t.Errorf("Событие %d: ожидался тип %s, получен %s", i, want[i], ev.Type)
+		}
+		if i > 0 && ev.Seq <= events[i-1].Seq {
+			t.Errorf("Номера событий не возрастают: %d после %d", ev.Seq, events[i-1].Seq)
+		}
+	}
+	if events[2].AgentID != "events-agent" {
+		t.Errorf("Ожидался агент events-agent в событии выдачи, получено %+v", events[2])
+	}
+	if last := events[len(events)-1]; last.Expression == nil || *last.Expression.Result != 9 {
+		t.Errorf("Событие завершения должно содержать результат 9: %+v", last)
+	}
+
+	if _, status := getEvents(t, ts.URL, "unknown"); status != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для неизвестного выражения, получен %d", status)
+	}
+}
+
+func TestEventLogReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	first := orchestrator.NewServer()
+	if err := first.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при открытии журнала: %v", err)
+	}
+	ts := httptest.NewServer(first.Router)
+	mulID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*(3+4)"})
+	divID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1/0"})
+
+	tasks, _ := fetchTasks(t, ts.URL, 3)
+	var answered models.Result
+	var ack models.ResultAck
+	for _, task := range tasks {
+		switch {
+		case task.ExpressionID == divID:
+			submitResults(t, ts.URL, models.Result{ID: task.ID, Error: "деление на ноль"})
+		case answered.ID == "":
+			answered = computeResult(task)
+			ack = submitResults(t, ts.URL, answered)[0]
+		}
+		// Вторая задача умножения остаётся у агента без ответа.
+	}
+	ts.Close()
+	first.Events.Close()
+
+	// Имитируем запись, прерванную сбоем.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"seq":999,"type":"subm`)
+	f.Close()
+
+	second := orchestrator.NewServer()
+	if err := second.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при воспроизведении журнала: %v", err)
+	}
+	defer second.Events.Close()
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+
+	if expr := getExpression(t, ts.URL, divID); expr.Status != "error" {
+		t.Errorf("Ожидался статус error после воспроизведения, получен %s", expr.Status)
+	}
+	if dup := submitResults(t, ts.URL, answered)[0]; dup != ack {
+		t.Errorf("Ожидалось прежнее подтверждение %+v, получено %+v", ack, dup)
+	}
+	if expr := getExpression(t, ts.URL, mulID); expr.ComputedNodes != 1 {
+		t.Errorf("Ожидалась 1 вычисленная операция после воспроизведения, получено %d", expr.ComputedNodes)
+	}
+	if n := drainTasks(t, ts.URL); n != 2 {
+		t.Errorf("Ожидалось 2 оставшиеся задачи (возвращённая и умножение), выполнено %d", n)
+	}
+	if expr := getExpression(t, ts.URL, mulID); expr.Status != "completed" || *expr.Result != 21 {
+		t.Errorf("Ожидался результат 21, получено %+v", expr)
+	}
+
+	events, _ := getEvents(t, ts.URL, mulID)
+	if events[0].Type != models.EventSubmitted || events[len(events)-1].Type != models.EventCompleted {
+		t.Errorf("Журнал должен содержать события до и после перезапуска: %+v", events)
+	}
+}
+
+func TestEventLogReplayAcceptsLateResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	first := orchestrator.NewServer()
+	if err := first.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при открытии журнала: %v", err)
+	}
+	ts := httptest.NewServer(first.Router)
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "6/3"})
+	task := agentTask(t, ts.URL, "worker")
+	ts.Close()
+	first.Events.Close()
+
+	second := orchestrator.NewServer()
+	if err := second.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при воспроизведении журнала: %v", err)
+	}
+	defer second.Events.Close()
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+
+	if ack := agentResult(t, ts.URL, "stranger", computeResult(task)); ack.Status != http.StatusPreconditionFailed {
+		t.Errorf("Ожидался статус 412 для результата другого агента, получено %+v", ack)
+	}
+	if ack := agentResult(t, ts.URL, "worker", computeResult(task)); ack.Status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK для результата, выданной до перезапуска задачи, получено %+v", ack)
+	}
+	if report := second.Report(); report.QueuedTasks != 0 {
+		t.Errorf("Возвращённая в очередь копия задачи не удалена: %+v", report)
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "completed" || *expr.Result != 2 {
+		t.Errorf("Ожидался результат 2, получено %+v", expr)
+	}
+}
+
+func TestEventLogCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	first := orchestrator.NewServer()
+	if err := first.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при открытии журнала: %v", err)
+	}
+	ts := httptest.NewServer(first.Router)
+	doneID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*3"})
+	drainTasks(t, ts.URL)
+	activeID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(2+2)*(3+3)"})
+	fetchTask(t, ts.URL)
+	if err := first.CompactEventLog(); err != nil {
+		t.Fatalf("Ошибка при сжатии журнала: %v", err)
+	}
+	ts.Close()
+	first.Events.Close()
+
+	events, err := orchestrator.ReadEvents(path)
+	if err != nil {
+		t.Fatalf("Ошибка при чтении журнала: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, ev := range events {
+		counts[ev.ExpressionID]++
+		if ev.ExpressionID == doneID && ev.Type != models.EventCompacted {
+			t.Errorf("История завершённого выражения не сжата: %+v", ev)
+		}
+	}
+	if counts[doneID] != 1 || counts[activeID] < 2 {
+		t.Errorf("Неверное содержимое сжатого журнала: %v", counts)
+	}
+
+	second := orchestrator.NewServer()
+	if err := second.OpenEventLog(path); err != nil {
+		t.Fatalf("Ошибка при воспроизведении журнала: %v", err)
+	}
+	defer second.Events.Close()
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+	if expr := getExpression(t, ts.URL, doneID); expr.Status != models.StatusCompleted || *expr.Result != 9 {
+		t.Errorf("Ожидался результат 9 после сжатия, получено %+v", expr)
+	}
+	drainTasks(t, ts.URL)
+	if expr := getExpression(t, ts.URL, activeID); expr.Status != models.StatusCompleted || *expr.Result != 24 {
+		t.Errorf("Ожидался результат 24 после сжатия, получено %+v", expr)
+	}
+}
+
+func TestEventLogKeepsFinishedInMemory(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.Events.MaxFinished = 1
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	firstID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+1"})
+	drainTasks(t, ts.URL)
+	secondID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2"})
+	drainTasks(t, ts.URL)
+
+	if events, _ := getEvents(t, ts.URL, firstID); len(events) != 0 {
+		t.Errorf("События самого старого завершённого выражения должны быть вытеснены, получено %d", len(events))
+	}
+	if events, _ := getEvents(t, ts.URL, secondID); len(events) == 0 || events[len(events)-1].Type != models.EventCompleted {
+		t.Errorf("События последнего выражения должны храниться, получено %+v", events)
+	}
+}
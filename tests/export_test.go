@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func export(t *testing.T, baseURL, format string) []byte {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/export?format=" + format)
+	if err != nil {
+		t.Fatalf("Ошибка запроса выгрузки: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен %d", resp.StatusCode)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return data
+}
+
+func importDump(t *testing.T, baseURL, contentType string, dump []byte) orchestrator.ImportReport {
+	t.Helper()
+	resp, err := http.Post(baseURL+"/api/v1/import", contentType, strings.NewReader(string(dump)))
+	if err != nil {
+		t.Fatalf("Ошибка запроса импорта: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен %d", resp.StatusCode)
+	}
+	var report orchestrator.ImportReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	return report
+}
+
+// exportFixture создаёт на новом сервере выражение с ошибкой, вычисленное
+// и ещё не вычисленное выражения и возвращает их ID в этом порядке.
+func exportFixture(t *testing.T, baseURL string) (string, string, string) {
+	errID := submitExpression(t, baseURL, map[string]interface{}{"expression": "8/0"})
+	tasks, _ := fetchTasks(t, baseURL, 1)
+	submitResults(t, baseURL, models.Result{ID: tasks[0].ID, Error: "деление на ноль"})
+
+	doneID := submitExpression(t, baseURL, map[string]interface{}{"expression": "2*3"})
+	drainTasks(t, baseURL)
+	pendingID := submitExpression(t, baseURL, map[string]interface{}{"expression": "(1+2)*4", "priority": 3})
+	return errID, doneID, pendingID
+}
+
+func checkImported(t *testing.T, baseURL, errID, doneID, pendingID string) {
+	t.Helper()
+	if expr := getExpression(t, baseURL, errID); expr.Status != "error" || expr.Error != "деление на ноль" {
+		t.Errorf("Неверно загружено выражение с ошибкой: %+v", expr)
+	}
+	if expr := getExpression(t, baseURL, doneID); expr.Status != "completed" || expr.Result == nil || *expr.Result != 6 {
+		t.Errorf("Неверно загружено вычисленное выражение: %+v", expr)
+	}
+	pending := getExpression(t, baseURL, pendingID)
+	if pending.Status != "pending" || pending.Priority != 3 || pending.Text != "(1+2)*4" {
+		t.Errorf("Неверно загружено невычисленное выражение: %+v", pending)
+	}
+	if n := drainTasks(t, baseURL); n != 2 {
+		t.Errorf("Ожидалось 2 задачи невычисленного выражения, выполнено %d", n)
+	}
+	if expr := getExpression(t, baseURL, pendingID); expr.Status != "completed" || *expr.Result != 12 {
+		t.Errorf("Загруженное выражение не вычислено: %+v", expr)
+	}
+}
+
+func TestExportImportJSONL(t *testing.T) {
+	source := httptest.NewServer(orchestrator.NewServer().Router)
+	defer source.Close()
+	errID, doneID, pendingID := exportFixture(t, source.URL)
+
+	dump := export(t, source.URL, "jsonl")
+	var ids []string
+	scanner := bufio.NewScanner(strings.NewReader(string(dump)))
+	for scanner.Scan() {
+		var expr models.Expression
+		if err := json.Unmarshal(scanner.Bytes(), &expr); err != nil {
+			t.Fatalf("Строка выгрузки не разбирается: %v", err)
+		}
+		ids = append(ids, expr.ID)
+	}
+	if strings.Join(ids, ",") != strings.Join([]string{errID, doneID, pendingID}, ",") {
+		t.Errorf("Ожидались выражения в порядке создания, получено %v", ids)
+	}
+
+	target := httptest.NewServer(orchestrator.NewServer().Router)
+	defer target.Close()
+	report := importDump(t, target.URL, "application/x-ndjson", dump)
+	if report.Imported != 3 || report.Rescheduled != 1 || report.Skipped != 0 || len(report.Errors) != 0 {
+		t.Errorf("Неверный итог импорта: %+v", report)
+	}
+	if again := importDump(t, target.URL, "application/x-ndjson", dump); again.Skipped != 3 || again.Imported != 0 {
+		t.Errorf("Повторный импорт должен пропустить существующие выражения: %+v", again)
+	}
+	checkImported(t, target.URL, errID, doneID, pendingID)
+}
+
+func TestExportImportCSV(t *testing.T) {
+	source := httptest.NewServer(orchestrator.NewServer().Router)
+	defer source.Close()
+	errID, doneID, pendingID := exportFixture(t, source.URL)
+
+	dump := export(t, source.URL, "csv")
+	rows, err := csv.NewReader(strings.NewReader(string(dump))).ReadAll()
+	if err != nil {
+		t.Fatalf("Выгрузка не разбирается как CSV: %v", err)
+	}
+	if len(rows) != 4 || rows[0][0] != "id" || rows[2][1] != "2*3" || rows[2][3] != "6" {
+		t.Errorf("Неверная выгрузка CSV: %v", rows)
+	}
+
+	target := httptest.NewServer(orchestrator.NewServer().Router)
+	defer target.Close()
+	report := importDump(t, target.URL, "text/csv", dump)
+	if report.Imported != 3 || report.Rescheduled != 1 {
+		t.Errorf("Неверный итог импорта: %+v", report)
+	}
+	checkImported(t, target.URL, errID, doneID, pendingID)
+}
+
+func TestImportRejectsBadRecords(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	dump := `{"id":"a","text":"1+","status":"pending"}
+{"status":"completed","result":1}
+{"id":"b","text":"1+1","status":"pending"}
+`
+	report := importDump(t, ts.URL, "application/x-ndjson", []byte(dump))
+	if report.Imported != 1 || len(report.Errors) != 2 || report.Errors[0].Line != 1 || report.Errors[1].Line != 2 {
+		t.Errorf("Неверный итог импорта: %+v", report)
+	}
+}
+
+func TestImportContinuesAfterMalformedRecord(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+
+	jsonl := `{"id":"j1","text":"1+1","status":"pending"}
+{"id":"j2","text":
+{"id":"j3","text":"2+2","status":"pending"}
+`
+	report := importDump(t, ts.URL, "application/x-ndjson", []byte(jsonl))
+	if report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0].Line != 2 {
+		t.Errorf("Неверный итог импорта JSONL: %+v", report)
+	}
+
+	csvDump := "id,text,status,created_at\n" +
+		"c1,1+1,pending,\n" +
+		"c2,2+2,pending,вчера\n" +
+		"c3,3+3,pending,\n"
+	report = importDump(t, ts.URL, "text/csv", []byte(csvDump))
+	if report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Errorf("Неверный итог импорта CSV: %+v", report)
+	}
+	for _, id := range []string{"j1", "j3", "c1", "c3"} {
+		if expr := getExpression(t, ts.URL, id); expr.ID != id {
+			t.Errorf("Выражение %s не загружено: %+v", id, expr)
+		}
+	}
+}
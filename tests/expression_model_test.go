@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func TestExpressionProgress(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*3"})
+
+	expr := getExpression(t, ts.URL, id)
+	if expr.Status != "pending" || expr.Text != "(1+2)*3" || expr.TotalNodes != 2 || expr.ComputedNodes != 0 || expr.StartedAt != nil {
+		t.Fatalf("Неверное состояние нового выражения: %+v", expr)
+	}
+
+	task := fetchTask(t, ts.URL)
+	expr = getExpression(t, ts.URL, id)
+	if expr.Status != "in_progress" || expr.StartedAt == nil || expr.StartedAt.Before(expr.CreatedAt) {
+		t.Fatalf("После выдачи задачи ожидался статус in_progress: %+v", expr)
+	}
+	submitResults(t, ts.URL, computeResult(task))
+	if expr = getExpression(t, ts.URL, id); expr.ComputedNodes != 1 || expr.FinishedAt != nil {
+		t.Errorf("Ожидалась одна вычисленная операция: %+v", expr)
+	}
+
+	drainTasks(t, ts.URL)
+	expr = getExpression(t, ts.URL, id)
+	if expr.Status != "completed" || expr.ComputedNodes != 2 || expr.FinishedAt == nil || expr.FinishedAt.Before(*expr.StartedAt) {
+		t.Errorf("Неверное состояние вычисленного выражения: %+v", expr)
+	}
+
+	listed := listExpressions(t, ts.URL)
+	if len(listed) != 1 || listed[0].Text != expr.Text || listed[0].ComputedNodes != 2 || listed[0].FinishedAt == nil {
+		t.Errorf("Список выражений не содержит новых полей: %+v", listed)
+	}
+}
+
+func TestExpressionErrorDetail(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	errID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1/0"})
+	task := fetchTask(t, ts.URL)
+	submitResults(t, ts.URL, models.Result{ID: task.ID, Error: "деление на ноль"})
+	expr := getExpression(t, ts.URL, errID)
+	if expr.Status != "error" || expr.ErrorCode != models.ErrorCodeEvaluation || expr.Error != "деление на ноль" || expr.FinishedAt == nil {
+		t.Errorf("Неверные сведения об ошибке: %+v", expr)
+	}
+
+	timeoutID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2", "timeout": "50ms"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.RunWatchdog(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if expr = getExpression(t, ts.URL, timeoutID); expr.Status == "timeout" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if expr.Status != "timeout" || expr.ErrorCode != models.ErrorCodeTimeout || expr.FinishedAt == nil {
+		t.Errorf("Неверные сведения о таймауте: %+v", expr)
+	}
+}
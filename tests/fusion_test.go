@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+	"github.com/Diverstt/Calculator_Yandex/internal/taskpb"
+)
+
+// evalTaskNode вычисляет поддерево задачи так же, как агент, и собирает
+// результаты узлов.
+func evalTaskNode(node *models.TaskNode, timings *[]models.NodeTiming) float64 {
+	if node.Operation == "" {
+		return node.Value
+	}
+	left, right := evalTaskNode(node.Left, timings), evalTaskNode(node.Right, timings)
+	var value float64
+	switch node.Operation {
+	case "+":
+		value = left + right
+	case "-":
+		value = left - right
+	case "*":
+		value = left * right
+	case "/":
+		value = left / right
+	}
+	*timings = append(*timings, models.NodeTiming{ID: node.ID, Result: value, Duration: time.Millisecond})
+	return value
+}
+
+func TestSubtreeFusion(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.FusionMaxNodes = 3
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*(3+4)-5*6"})
+
+	tasks, _ := fetchTasks(t, ts.URL, 10)
+	if len(tasks) != 2 {
+		t.Fatalf("Ожидалось 2 задачи (поддерево и умножение), получено %d", len(tasks))
+	}
+	var results []models.Result
+	var fused *models.Task
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Subtree == nil {
+			results = append(results, models.Result{ID: task.ID, Result: task.Arg1 * task.Arg2})
+			continue
+		}
+		fused = task
+		if ops := task.Operations(); len(ops) != 3 {
+			t.Errorf("Ожидалось 3 операции в поддереве, получено %v", ops)
+		}
+		if want := 2*parser.GetOperationTime("+") + parser.GetOperationTime("*"); task.OperationTime != want {
+			t.Errorf("Ожидалось суммарное время %d, получено %d", want, task.OperationTime)
+		}
+		res := models.Result{ID: task.ID}
+		res.Result = evalTaskNode(task.Subtree, &res.Timings)
+		results = append(results, res)
+	}
+	if fused == nil {
+		t.Fatal("Поддерево не объединено в одну задачу")
+	}
+	if decoded := taskpb.FromTask(fused).ToModel(); !reflect.DeepEqual(decoded.Subtree, fused.Subtree) {
+		t.Errorf("Поддерево искажено при преобразовании в protobuf: %+v", decoded.Subtree)
+	}
+
+	resp := postJSON(t, ts.URL+"/internal/task/results", map[string]interface{}{"results": results}, nil)
+	resp.Body.Close()
+
+	// Внутренние узлы поддерева получают значения из отчёта агента.
+	server.Mutex.Lock()
+	inner := parser.FindNodeByID(server.ASTs[exprID], fused.Subtree.Left.ID)
+	computed, value := inner.Computed, inner.Value
+	server.Mutex.Unlock()
+	if !computed || value != 3 {
+		t.Errorf("Ожидалось вычисленное значение 3 для узла %s, получено %v (%f)", fused.Subtree.Left.ID, computed, value)
+	}
+	// Поддерево засчитывается всеми тремя операциями, умножение — одной.
+	if expr := getExpression(t, ts.URL, exprID); expr.ComputedNodes != 4 {
+		t.Errorf("Ожидалось 4 вычисленные операции, получено %d", expr.ComputedNodes)
+	}
+
+	task := fetchTask(t, ts.URL)
+	if task.Operation != "-" || task.Arg1 != 21 || task.Arg2 != 30 {
+		t.Fatalf("Ожидалась задача 21 - 30, получено %+v", task)
+	}
+	postJSON(t, ts.URL+"/internal/task/result", models.Result{ID: task.ID, Result: task.Arg1 - task.Arg2}, nil).Body.Close()
+
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "completed" || expr.Result == nil || *expr.Result != -9 || expr.ComputedNodes != expr.TotalNodes {
+		t.Errorf("Ожидался результат -9, получено %+v", expr)
+	}
+}
+
+func TestSubtreeFusionThresholds(t *testing.T) {
+	t.Setenv("TIME_ADDITION_MS", "100")
+	tests := []struct {
+		name     string
+		maxNodes int
+		maxTime  int
+		tasks    int
+	}{
+		{"отключено", 1, 0, 2},
+		{"по числу узлов", 3, 0, 1},
+		{"число узлов превышено", 2, 0, 2},
+		{"по времени", 10, 300, 1},
+		{"время превышено", 10, 250, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := orchestrator.NewServer()
+			server.FusionMaxNodes = tt.maxNodes
+			server.FusionMaxTime = tt.maxTime
+			ts := httptest.NewServer(server.Router)
+			defer ts.Close()
+
+			submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)+(3+4)"})
+			if tasks, _ := fetchTasks(t, ts.URL, 10); len(tasks) != tt.tasks {
+				t.Errorf("Ожидалось %d задач, получено %d", tt.tasks, len(tasks))
+			}
+		})
+	}
+}
+
+// fetchTask запрашивает одну задачу без ожидания.
+func fetchTask(t *testing.T, baseURL string) models.Task {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/internal/task")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус OK при запросе задачи, получен %d", resp.StatusCode)
+	}
+	var taskRes map[string]models.Task
+	json.NewDecoder(resp.Body).Decode(&taskRes)
+	return taskRes["task"]
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/taskpb"
+)
+
+func TestGRPCTaskService(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Не удалось открыть порт: %v", err)
+	}
+	grpcServer := server.NewGRPCServer()
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := agent.DialGRPC(listener.Addr().String(), "grpc-agent", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось подключиться к gRPC-сервису: %v", err)
+	}
+	defer conn.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*4"})
+
+	type received struct {
+		task *models.Task
+		err  error
+	}
+	recv := func() *models.Task {
+		ch := make(chan received, 1)
+		go func() {
+			task, err := conn.Recv()
+			ch <- received{task, err}
+		}()
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				t.Fatalf("Ошибка при получении задачи: %v", r.err)
+			}
+			return r.task
+		case <-time.After(2 * time.Second):
+			t.Fatal("Задача не получена по gRPC")
+		}
+		return nil
+	}
+
+	task := recv()
+	if task.Operation != "+" || task.ExpressionID != exprID {
+		t.Fatalf("Ожидалась задача сложения выражения %s, получена %+v", exprID, task)
+	}
+	if err := conn.Send(models.Result{ID: task.ID, Result: 3}); err != nil {
+		t.Fatalf("Ошибка при отправке результата: %v", err)
+	}
+	task = recv()
+	if task.Operation != "*" || task.Arg1 != 3 {
+		t.Fatalf("Ожидалась задача 3*4, получена %+v", task)
+	}
+	if err := conn.Send(models.Result{ID: task.ID, Result: 12}); err != nil {
+		t.Fatalf("Ошибка при отправке результата: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for getExpression(t, ts.URL, exprID).Status != "completed" {
+		if time.Now().After(deadline) {
+			t.Fatal("Выражение не вычислено через gRPC")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Result == nil || *expr.Result != 12 {
+		t.Errorf("Ожидался результат 12, получено %v", expr.Result)
+	}
+
+	// HTTP-эндпоинты продолжают работать параллельно с gRPC.
+	resp, err := http.Get(ts.URL + "/internal/task")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404, получен %d", resp.StatusCode)
+	}
+}
+
+func TestTaskProtoRoundTrip(t *testing.T) {
+	deadline := time.Unix(1700000000, 123)
+	task := &models.Task{ID: "e-1", ExpressionID: "e", Arg1: 1.5, Arg2: 2, Operation: "/", OperationTime: 4000, Priority: 9000, ExpressionPriority: 3, Deadline: &deadline}
+	got := taskpb.FromTask(task).ToModel()
+	if got.ID != task.ID || got.Arg1 != task.Arg1 || got.Operation != task.Operation ||
+		got.Priority != task.Priority || got.ExpressionPriority != task.ExpressionPriority ||
+		got.Deadline == nil || !got.Deadline.Equal(deadline) {
+		t.Errorf("Задача изменилась при преобразовании: %+v", got)
+	}
+}
+
+func BenchmarkTaskEncoding(b *testing.B) {
+	deadline := time.Now()
+	task := &models.Task{ID: "20240101120000-3", ExpressionID: "20240101120000", Arg1: 12.5, Arg2: 3, Operation: "*", OperationTime: 3000, Priority: 5000, Deadline: &deadline}
+
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			data, _ := json.Marshal(task)
+			var decoded models.Task
+			json.Unmarshal(data, &decoded)
+		}
+	})
+	b.Run("protobuf", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			data, _ := proto.Marshal(taskpb.FromTask(task))
+			var decoded taskpb.Task
+			proto.Unmarshal(data, &decoded)
+			decoded.ToModel()
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/storage"
+)
+
+type listPage struct {
+	Expressions []models.Expression `json:"expressions"`
+	Total       int                 `json:"total"`
+	NextCursor  string              `json:"next_cursor"`
+}
+
+func queryExpressions(t *testing.T, baseURL string, params url.Values) (listPage, int) {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/expressions?" + params.Encode())
+	if err != nil {
+		t.Fatalf("Ошибка запроса списка выражений: %v", err)
+	}
+	defer resp.Body.Close()
+	var page listPage
+	if resp.StatusCode == http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&page)
+	}
+	return page, resp.StatusCode
+}
+
+// listExpressions возвращает первую страницу списка выражений без фильтров.
+func listExpressions(t *testing.T, baseURL string) []models.Expression {
+	t.Helper()
+	page, _ := queryExpressions(t, baseURL, nil)
+	return page.Expressions
+}
+
+// collectPages проходит список страницами по limit и возвращает ID в порядке выдачи.
+func collectPages(t *testing.T, baseURL string, params url.Values, limit int, between func()) []string {
+	t.Helper()
+	params.Set("limit", strconv.Itoa(limit))
+	var ids []string
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("Слишком много страниц")
+		}
+		page, status := queryExpressions(t, baseURL, params)
+		if status != http.StatusOK {
+			t.Fatalf("Ожидался статус 200, получен %d", status)
+		}
+		if len(page.Expressions) > limit {
+			t.Fatalf("Страница длиннее limit: %d", len(page.Expressions))
+		}
+		for _, expr := range page.Expressions {
+			ids = append(ids, expr.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		params.Set("cursor", page.NextCursor)
+		if between != nil {
+			between()
+		}
+	}
+}
+
+func TestExpressionListPagination(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	var created []string
+	for i := 0; i < 7; i++ {
+		created = append(created, submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+1", "priority": i % 3}))
+	}
+
+	page, _ := queryExpressions(t, ts.URL, url.Values{"limit": {"3"}})
+	if page.Total != 7 || len(page.Expressions) != 3 || page.NextCursor == "" {
+		t.Fatalf("Неверная первая страница: total=%d, len=%d", page.Total, len(page.Expressions))
+	}
+
+	// Новые выражения, добавленные во время обхода, не нарушают его:
+	// ни одно выражение не пропущено и не повторено.
+	var added []string
+	ids := collectPages(t, ts.URL, url.Values{}, 3, func() {
+		if len(added) == 0 {
+			added = append(added, submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2"}))
+		}
+	})
+	want := append(append([]string{}, created...), added...)
+	if len(ids) != len(want) {
+		t.Fatalf("Ожидалось %v, получено %v", want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Ожидалось %v, получено %v", want, ids)
+		}
+	}
+
+	desc := collectPages(t, ts.URL, url.Values{"sort": {"-created_at"}}, 2, nil)
+	for i := range desc {
+		if desc[i] != want[len(want)-1-i] {
+			t.Fatalf("Ожидался обратный порядок создания, получено %v", desc)
+		}
+	}
+
+	byPriority := collectPages(t, ts.URL, url.Values{"sort": {"-priority"}}, 4, nil)
+	if len(byPriority) != 8 {
+		t.Fatalf("Ожидалось 8 выражений, получено %d", len(byPriority))
+	}
+	page, _ = queryExpressions(t, ts.URL, url.Values{"sort": {"-priority"}})
+	for i := 1; i < len(page.Expressions); i++ {
+		if page.Expressions[i-1].Priority < page.Expressions[i].Priority {
+			t.Fatalf("Выражения не упорядочены по убыванию приоритета")
+		}
+	}
+	for i := range byPriority {
+		if byPriority[i] != page.Expressions[i].ID {
+			t.Fatalf("Постраничный обход расходится с полным списком: %v", byPriority)
+		}
+	}
+}
+
+func TestExpressionListFilters(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	first := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+2"})
+	drainTasks(t, ts.URL)
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	second := submitExpression(t, ts.URL, map[string]interface{}{"expression": "3+4"})
+
+	page, _ := queryExpressions(t, ts.URL, url.Values{"status": {"completed"}})
+	if page.Total != 1 || len(page.Expressions) != 1 || page.Expressions[0].ID != first {
+		t.Errorf("Фильтр по статусу вернул %+v", page)
+	}
+	page, _ = queryExpressions(t, ts.URL, url.Values{"status": {"pending"}})
+	if page.Total != 1 || page.Expressions[0].ID != second {
+		t.Errorf("Фильтр по статусу pending вернул %+v", page)
+	}
+	page, _ = queryExpressions(t, ts.URL, url.Values{"since": {since.Format(time.RFC3339Nano)}})
+	if page.Total != 1 || page.Expressions[0].ID != second {
+		t.Errorf("Фильтр since вернул %+v", page)
+	}
+
+	drainTasks(t, ts.URL)
+	page, _ = queryExpressions(t, ts.URL, url.Values{"status": {"completed"}, "sort": {"-finished_at"}})
+	if page.Total != 2 || page.Expressions[0].ID != second {
+		t.Errorf("Индекс не обновился после вычисления: %+v", page)
+	}
+
+	cursorPage, _ := queryExpressions(t, ts.URL, url.Values{"limit": {"1"}})
+	for _, params := range []url.Values{
+		{"status": {"done"}},
+		{"since": {"вчера"}},
+		{"limit": {"0"}},
+		{"sort": {"text"}},
+		{"cursor": {"не курсор"}},
+		{"cursor": {cursorPage.NextCursor}, "sort": {"-created_at"}},
+	} {
+		if _, status := queryExpressions(t, ts.URL, params); status != http.StatusBadRequest {
+			t.Errorf("Параметры %v: ожидался статус 400, получен %d", params, status)
+		}
+	}
+}
+
+// sortValue повторяет порядок сортировки списка: отсутствующее время меньше любого.
+func sortValue(expr models.Expression, field string) int64 {
+	optional := func(t *time.Time) int64 {
+		if t == nil {
+			return 0
+		}
+		return t.UnixNano()
+	}
+	switch field {
+	case "created_at":
+		return expr.CreatedAt.UnixNano()
+	case "started_at":
+		return optional(expr.StartedAt)
+	case "finished_at":
+		return optional(expr.FinishedAt)
+	case "priority":
+		return int64(expr.Priority)
+	}
+	return 0
+}
+
+func TestExpressionIndexMatchesFullSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	statuses := []models.ExpressionStatus{models.StatusPending, models.StatusInProgress, models.StatusCompleted, models.StatusError}
+	base := time.Now()
+	at := func() *time.Time {
+		if rnd.Intn(3) == 0 {
+			return nil
+		}
+		tm := base.Add(time.Duration(rnd.Intn(50)) * time.Second)
+		return &tm
+	}
+
+	index := storage.NewExpressionIndex()
+	exprs := make(map[string]models.Expression)
+	for i := 0; i < 300; i++ {
+		id := fmt.Sprintf("e%03d", rnd.Intn(120))
+		expr, ok := exprs[id]
+		if !ok {
+			expr = models.Expression{ID: id, CreatedAt: base.Add(time.Duration(rnd.Intn(40)) * time.Second)}
+		}
+		expr.Status = statuses[rnd.Intn(len(statuses))]
+		expr.Priority = rnd.Intn(5) - 2
+		expr.StartedAt, expr.FinishedAt = at(), at()
+		exprs[id] = expr
+		index.Put(expr)
+	}
+
+	since := base.Add(20 * time.Second)
+	for _, status := range append([]models.ExpressionStatus{""}, statuses...) {
+		for _, field := range storage.SortFields {
+			for _, sortParam := range []string{field, "-" + field} {
+				for _, from := range []time.Time{{}, since} {
+					var want []models.Expression
+					for _, expr := range exprs {
+						if (status == "" || expr.Status == status) && !expr.CreatedAt.Before(from) {
+							want = append(want, expr)
+						}
+					}
+					desc := sortParam[0] == '-'
+					sort.Slice(want, func(i, j int) bool {
+						ki, kj := sortValue(want[i], field), sortValue(want[j], field)
+						if ki != kj {
+							return (ki < kj) != desc
+						}
+						return (want[i].ID < want[j].ID) != desc
+					})
+
+					var got []string
+					q := storage.ListQuery{Status: status, Since: from, Limit: 7, Sort: sortParam}
+					for pages := 0; ; pages++ {
+						page, err := index.Query(q)
+						if err != nil || pages > 100 {
+							t.Fatalf("%s %s: ошибка выборки: %v", status, sortParam, err)
+						}
+						if page.Total != len(want) {
+							t.Fatalf("%s %s: ожидалось всего %d, получено %d", status, sortParam, len(want), page.Total)
+						}
+						for _, expr := range page.Expressions {
+							got = append(got, expr.ID)
+						}
+						if page.NextCursor == "" {
+							break
+						}
+						q.Cursor = page.NextCursor
+					}
+					if len(got) != len(want) {
+						t.Fatalf("%s %s с %v: ожидалось %d выражений, получено %d", status, sortParam, from, len(want), len(got))
+					}
+					for i := range want {
+						if got[i] != want[i].ID {
+							t.Fatalf("%s %s с %v: позиция %d — ожидалось %s, получено %s", status, sortParam, from, i, want[i].ID, got[i])
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/retry"
+)
+
+// flakyTransport отклоняет первые failures попыток отправки.
+type flakyTransport struct {
+	mu        sync.Mutex
+	failures  int
+	delivered []models.Result
+}
+
+func (f *flakyTransport) Fetch(ctx context.Context) (*models.Task, error) {
+	return nil, nil
+}
+
+func (f *flakyTransport) Close() error {
+	return nil
+}
+
+func (f *flakyTransport) Submit(res models.Result) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures != 0 {
+		f.failures--
+		return errors.New("сеть недоступна")
+	}
+	f.delivered = append(f.delivered, res)
+	return nil
+}
+
+func (f *flakyTransport) Delivered() []models.Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.Result(nil), f.delivered...)
+}
+
+// waitDelivered ждёт, пока транспорт получит n результатов.
+func waitDelivered(t *testing.T, f *flakyTransport, n int, timeout time.Duration) []models.Result {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if delivered := f.Delivered(); len(delivered) >= n {
+			return delivered
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("За %s доставлено %d результатов из %d", timeout, len(f.Delivered()), n)
+	return nil
+}
+
+func TestBackoffGrowsWithJitter(t *testing.T) {
+	b := &retry.Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+	for i, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		if d := b.Next(); d < want/2 || d >= want {
+			t.Errorf("Попытка %d: пауза %s вне диапазона [%s, %s)", i+1, d, want/2, want)
+		}
+	}
+	b.Reset()
+	if d := b.Next(); d >= 100*time.Millisecond {
+		t.Errorf("После сброса ожидалась пауза меньше 100ms, получено %s", d)
+	}
+}
+
+func TestOutboxRetriesFailedSubmit(t *testing.T) {
+	transport := &flakyTransport{failures: 1}
+	outbox, err := agent.NewOutbox(transport, "")
+	if err != nil {
+		t.Fatalf("Ошибка при создании очереди отправки: %v", err)
+	}
+	outbox.Submit(models.Result{ID: "a-1", Result: 1})
+	outbox.Submit(models.Result{ID: "a-2", Result: 2})
+
+	delivered := waitDelivered(t, transport, 2, 3*time.Second)
+	if delivered[0].ID != "a-1" || delivered[1].ID != "a-2" {
+		t.Errorf("Результаты доставлены не по порядку: %+v", delivered)
+	}
+	if outbox.Pending() != 0 {
+		t.Errorf("Ожидалась пустая очередь, осталось %d", outbox.Pending())
+	}
+}
+
+func TestOutboxPersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	down := &flakyTransport{failures: -1}
+	outbox, err := agent.NewOutbox(down, path)
+	if err != nil {
+		t.Fatalf("Ошибка при создании очереди отправки: %v", err)
+	}
+	if err := outbox.Submit(models.Result{ID: "b-1", Result: 3}); err != nil {
+		t.Fatalf("Ошибка при сохранении результата: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) == 0 {
+		t.Fatalf("Результат не сохранён на диск: %v", err)
+	}
+
+	// Агент перезапущен: новая очередь загружает результат из файла.
+	up := &flakyTransport{}
+	if _, err := agent.NewOutbox(up, path); err != nil {
+		t.Fatalf("Ошибка при загрузке очереди отправки: %v", err)
+	}
+	if delivered := waitDelivered(t, up, 1, time.Second); delivered[0].ID != "b-1" {
+		t.Errorf("Доставлен не тот результат: %+v", delivered)
+	}
+}
+
+func TestDuplicateResultIsIdempotent(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*4"})
+	task := fetchTask(t, ts.URL)
+	for i := 0; i < 2; i++ {
+		resp := postJSON(t, ts.URL+"/internal/task/result", models.Result{ID: task.ID, Result: 3}, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Попытка %d: ожидался статус OK, получен %d", i+1, resp.StatusCode)
+		}
+	}
+
+	parent := fetchTask(t, ts.URL)
+	if _, status := fetchTasks(t, ts.URL, 10); status != http.StatusNotFound {
+		t.Errorf("Повторный результат не должен планировать родителя ещё раз, статус %d", status)
+	}
+	postJSON(t, ts.URL+"/internal/task/result", models.Result{ID: parent.ID, Result: 12}, nil).Body.Close()
+	postJSON(t, ts.URL+"/internal/task/result", models.Result{ID: parent.ID, Result: 99}, nil).Body.Close()
+	if expr := getExpression(t, ts.URL, exprID); expr.Result == nil || *expr.Result != 12 {
+		t.Errorf("Повторный результат изменил значение выражения: %+v", expr)
+	}
+}
@@ -80,3 +80,69 @@ func TestGetOperationTimeAndPriority(t *testing.T) {
 		t.Errorf("Ожидался приоритет сложения 1")
 	}
 }
+
+func TestCriticalPathTime(t *testing.T) {
+	os.Unsetenv("TIME_ADDITION_MS")
+	os.Unsetenv("TIME_MULTIPLICATIONS_MS")
+	os.Unsetenv("TIME_DIVISIONS_MS")
+
+	ast, err := parser.ParseExpression("1+2*(3/4)")
+	if err != nil {
+		t.Fatalf("Не удалось распарсить выражение: %v", err)
+	}
+	parser.AssignIDs("cp", ast)
+
+	div := ast.Right.Right
+	if div.Op != "/" {
+		t.Fatalf("Ожидался оператор '/', получен %s", div.Op)
+	}
+	// Деление (4000) -> умножение (3000) -> сложение (2000)
+	if got := parser.CriticalPathTime(div); got != 9000 {
+		t.Errorf("Ожидалась длина критического пути 9000, получено %d", got)
+	}
+	if got := parser.CriticalPathTime(ast); got != 2000 {
+		t.Errorf("Ожидалась длина критического пути корня 2000, получено %d", got)
+	}
+	if parser.CriticalPathTime(div) <= parser.CriticalPathTime(ast.Right) {
+		t.Errorf("Узел на более длинном пути должен иметь больший приоритет")
+	}
+}
+
+func TestNodeStateRoundTrip(t *testing.T) {
+	ast, err := parser.ParseExpression("(1+2)*3")
+	if err != nil {
+		t.Fatalf("Не удалось распарсить выражение: %v", err)
+	}
+	parser.AssignIDs("st", ast)
+	ast.Left.Value, ast.Left.Computed, ast.Scheduled = 3, true, true
+
+	restored := parser.FromState(parser.ToState(ast))
+	if restored.ID != ast.ID || !restored.Scheduled || restored.Computed {
+		t.Errorf("Неверно восстановлен корень: %+v", restored)
+	}
+	if left := restored.Left; left.Parent != restored || !left.Computed || left.Value != 3 {
+		t.Errorf("Неверно восстановлен левый узел: %+v", left)
+	}
+	if right := restored.Right; right.Parent != restored || right.Value != 3 {
+		t.Errorf("Неверно восстановлен правый узел: %+v", right)
+	}
+	if restored.Left.Left.Parent != restored.Left {
+		t.Errorf("Не восстановлена ссылка на родителя у листа")
+	}
+}
+
+func TestParseExpressionWithVars(t *testing.T) {
+	ast, err := parser.ParseExpressionWithVars("x*(y+1)", map[string]float64{"x": 2, "y": 4})
+	if err != nil {
+		t.Fatalf("Не удалось распарсить выражение с переменными: %v", err)
+	}
+	if ast.Op != "*" || !ast.Left.Computed || ast.Left.Value != 2 || ast.Right.Right.Value != 1 || ast.Right.Left.Value != 4 {
+		t.Errorf("Переменные подставлены неверно: %+v", ast)
+	}
+	if _, err := parser.ParseExpressionWithVars("x+z", map[string]float64{"x": 1}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестной переменной")
+	}
+	if _, err := parser.ParseExpression("x+1"); err == nil {
+		t.Error("Ожидалась ошибка для переменной без значения")
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// openProgress подключается к потоку SSE и возвращает канал разобранных
+// событий; канал закрывается, когда сервер завершает поток.
+func openProgress(t *testing.T, url string) <-chan models.ProgressEvent {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка подключения к потоку: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		t.Fatalf("Ожидался поток событий, получен %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan models.ProgressEvent, 100)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var eventType string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var ev models.ProgressEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil || ev.Type != eventType {
+					t.Errorf("Неверное событие потока: %q", line)
+					return
+				}
+				events <- ev
+			}
+		}
+	}()
+	return events
+}
+
+func nextProgress(t *testing.T, events <-chan models.ProgressEvent) models.ProgressEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatalf("Поток событий закрыт раньше времени")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Событие не получено")
+	}
+	return models.ProgressEvent{}
+}
+
+func expectProgress(t *testing.T, events <-chan models.ProgressEvent, eventType string, status models.ExpressionStatus) models.ProgressEvent {
+	t.Helper()
+	ev := nextProgress(t, events)
+	if ev.Type != eventType || (status != "" && (ev.Expression == nil || ev.Expression.Status != status)) {
+		t.Fatalf("Ожидалось событие %s со статусом %q, получено %+v", eventType, status, ev)
+	}
+	return ev
+}
+
+func TestExpressionProgressStream(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	// Закрывается после потоков событий (t.Cleanup выполняется в обратном порядке).
+	t.Cleanup(ts.Close)
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*3"})
+	events := openProgress(t, ts.URL+"/api/v1/expressions/"+id+"/events")
+
+	expectProgress(t, events, models.ProgressStatusChanged, models.StatusPending)
+	task := fetchTask(t, ts.URL)
+	expectProgress(t, events, models.ProgressStatusChanged, models.StatusInProgress)
+	submitResults(t, ts.URL, computeResult(task))
+	node := expectProgress(t, events, models.ProgressNodeCompleted, models.StatusInProgress)
+	if node.NodeID != task.ID || node.Value == nil || *node.Value != 3 || node.Expression.ComputedNodes != 1 {
+		t.Errorf("Неверное событие вычисления узла: %+v", node)
+	}
+
+	drainTasks(t, ts.URL)
+	root := expectProgress(t, events, models.ProgressNodeCompleted, "")
+	if root.Value == nil || *root.Value != 9 {
+		t.Errorf("Неверное значение корня: %+v", root)
+	}
+	expectProgress(t, events, models.ProgressStatusChanged, models.StatusCompleted)
+	final := expectProgress(t, events, models.ProgressResult, models.StatusCompleted)
+	if final.Expression.Result == nil || *final.Expression.Result != 9 {
+		t.Errorf("Неверный итог вычисления: %+v", final.Expression)
+	}
+	if final.ID <= root.ID {
+		t.Errorf("Идентификаторы событий должны возрастать")
+	}
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Errorf("После итога поток должен закрыться, получено %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Поток не закрыт после итога вычисления")
+	}
+
+	// Поток завершённого выражения сразу передаёт итог и закрывается.
+	done := openProgress(t, ts.URL+"/api/v1/expressions/"+id+"/events")
+	expectProgress(t, done, models.ProgressStatusChanged, models.StatusCompleted)
+	expectProgress(t, done, models.ProgressResult, models.StatusCompleted)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/expressions/unknown/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для неизвестного выражения, получен %d", resp.StatusCode)
+	}
+}
+
+func TestGlobalProgressStream(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	// Закрывается после потоков событий (t.Cleanup выполняется в обратном порядке).
+	t.Cleanup(ts.Close)
+	events := openProgress(t, ts.URL+"/api/v1/events")
+
+	first := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+2"})
+	second := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1/0"})
+	drainAll(t, ts.URL)
+
+	results := make(map[string]models.ExpressionStatus)
+	for len(results) < 2 {
+		if ev := nextProgress(t, events); ev.Type == models.ProgressResult {
+			results[ev.ExpressionID] = ev.Expression.Status
+		}
+	}
+	if results[first] != models.StatusCompleted || results[second] != models.StatusError {
+		t.Errorf("Неверные итоги в общем потоке: %v", results)
+	}
+}
+
+// drainAll выполняет все задачи, возвращая для деления на ноль ошибку, как агент.
+func drainAll(t *testing.T, baseURL string) {
+	t.Helper()
+	for {
+		tasks, status := fetchTasks(t, baseURL, 10)
+		if status != http.StatusOK {
+			return
+		}
+		for _, task := range tasks {
+			res := computeResult(task)
+			if task.Operation == "/" && task.Arg2 == 0 {
+				res = models.Result{ID: task.ID, Error: "деление на ноль"}
+			}
+			submitResults(t, baseURL, res)
+		}
+	}
+}
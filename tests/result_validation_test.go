@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// submitResults отправляет пакет результатов и возвращает подтверждения.
+func submitResults(t *testing.T, baseURL string, results ...models.Result) []models.ResultAck {
+	t.Helper()
+	resp := postJSON(t, baseURL+"/internal/task/results", map[string]interface{}{"results": results}, nil)
+	defer resp.Body.Close()
+	var ackRes struct {
+		Results []models.ResultAck `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ackRes); err != nil {
+		t.Fatalf("Не удалось декодировать подтверждения: %v", err)
+	}
+	return ackRes.Results
+}
+
+func TestResultValidation(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*(3+4)"})
+
+	// Результат для задачи, которой нет, и для задачи, ещё не выданной агенту.
+	acks := submitResults(t, ts.URL,
+		models.Result{ID: "no-such-task", Result: 1},
+		models.Result{ID: exprID + "-2", Result: 3},
+	)
+	if acks[0].Status != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404 для неизвестной задачи, получено %+v", acks[0])
+	}
+	if acks[1].Status != http.StatusPreconditionFailed {
+		t.Errorf("Ожидался статус 412 для невыданной задачи, получено %+v", acks[1])
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "pending" {
+		t.Fatalf("Невыданная задача не должна влиять на выражение, статус %s", expr.Status)
+	}
+
+	tasks, _ := fetchTasks(t, ts.URL, 10)
+	if len(tasks) != 2 {
+		t.Fatalf("Ожидалось 2 задачи, получено %d", len(tasks))
+	}
+	first := models.Result{ID: tasks[0].ID, Result: tasks[0].Arg1 + tasks[0].Arg2}
+	original := submitResults(t, ts.URL, first)[0]
+	if original.Status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK, получено %+v", original)
+	}
+
+	// Повтор с другим значением ничего не меняет и получает прежний ответ.
+	duplicate := submitResults(t, ts.URL, models.Result{ID: first.ID, Result: 100})[0]
+	if duplicate != original {
+		t.Errorf("Ожидалось исходное подтверждение %+v, получено %+v", original, duplicate)
+	}
+
+	errorRes := models.Result{ID: tasks[1].ID, Error: "сбой агента"}
+	original = submitResults(t, ts.URL, errorRes)[0]
+	if original.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("Ожидался статус 422 для ошибки вычисления, получено %+v", original)
+	}
+	if duplicate := submitResults(t, ts.URL, errorRes)[0]; duplicate != original {
+		t.Errorf("Ожидалось исходное подтверждение ошибки %+v, получено %+v", original, duplicate)
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "error" {
+		t.Errorf("Ожидался статус error, получен %s", expr.Status)
+	}
+}
+
+// agentResult отправляет результат от имени агента agentID и возвращает подтверждение.
+func agentResult(t *testing.T, baseURL, agentID string, res models.Result) models.ResultAck {
+	t.Helper()
+	resp := postJSON(t, baseURL+"/internal/task/results", map[string]interface{}{"results": []models.Result{res}},
+		http.Header{models.AgentIDHeader: {agentID}})
+	defer resp.Body.Close()
+	var ackRes struct {
+		Results []models.ResultAck `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ackRes); err != nil || len(ackRes.Results) != 1 {
+		t.Fatalf("Не удалось декодировать подтверждение: %v", err)
+	}
+	return ackRes.Results[0]
+}
+
+// agentTask запрашивает задачу от имени агента agentID.
+func agentTask(t *testing.T, baseURL, agentID string) models.Task {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/internal/task", nil)
+	req.Header.Set(models.AgentIDHeader, agentID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался статус OK при запросе задачи, получен %d", resp.StatusCode)
+	}
+	var taskRes map[string]models.Task
+	json.NewDecoder(resp.Body).Decode(&taskRes)
+	return taskRes["task"]
+}
+
+func TestResultFromOtherAgentRejected(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2"})
+	task := agentTask(t, ts.URL, "owner")
+	if ack := agentResult(t, ts.URL, "stranger", models.Result{ID: task.ID, Result: 4}); ack.Status != http.StatusPreconditionFailed {
+		t.Errorf("Ожидался статус 412 для результата другого агента, получено %+v", ack)
+	}
+	if ack := agentResult(t, ts.URL, "owner", models.Result{ID: task.ID, Result: 4}); ack.Status != http.StatusOK {
+		t.Errorf("Ожидался статус OK для результата агента-владельца, получено %+v", ack)
+	}
+}
+
+func TestLateResultFromRevokedAgent(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	for _, id := range []string{"slow", "fresh"} {
+		postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: id, ComputingPower: 1}, nil).Body.Close()
+	}
+
+	// Задача отозвана и ещё не выдана заново: результат принимается, а
+	// возвращённая в очередь копия удаляется.
+	queuedID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "3*3"})
+	task := agentTask(t, ts.URL, "slow")
+	postJSON(t, ts.URL+"/internal/agents/deregister", map[string]string{"id": "slow"}, nil).Body.Close()
+	if ack := agentResult(t, ts.URL, "slow", models.Result{ID: task.ID, Result: 9}); ack.Status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK для запоздавшего результата, получено %+v", ack)
+	}
+	if report := server.Report(); report.QueuedTasks != 0 {
+		t.Errorf("Копия задачи не удалена из очереди: %+v", report)
+	}
+	if expr := getExpression(t, ts.URL, queuedID); expr.Status != models.StatusCompleted || *expr.Result != 9 {
+		t.Errorf("Ожидался результат 9, получено %+v", expr)
+	}
+
+	// Задача выдана другому агенту: засчитывается тот результат, что пришёл
+	// первым, а второй получает то же подтверждение.
+	postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: "slow", ComputingPower: 1}, nil).Body.Close()
+	resentID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "5-1"})
+	task = agentTask(t, ts.URL, "slow")
+	postJSON(t, ts.URL+"/internal/agents/deregister", map[string]string{"id": "slow"}, nil).Body.Close()
+	if resent := agentTask(t, ts.URL, "fresh"); resent.ID != task.ID {
+		t.Fatalf("Ожидалась повторная выдача задачи %s, получена %+v", task.ID, resent)
+	}
+	late := agentResult(t, ts.URL, "slow", models.Result{ID: task.ID, Result: 4})
+	if late.Status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK для запоздавшего результата, получено %+v", late)
+	}
+	if ack := agentResult(t, ts.URL, "fresh", models.Result{ID: task.ID, Result: 4}); ack != late {
+		t.Errorf("Ожидалось подтверждение %+v для повторного результата, получено %+v", late, ack)
+	}
+	if expr := getExpression(t, ts.URL, resentID); expr.Status != models.StatusCompleted {
+		t.Errorf("Выражение не вычислено: %+v", expr)
+	}
+	if report := server.Report(); report.DispatchedTasks != 0 {
+		t.Errorf("Задача осталась выданной: %+v", report)
+	}
+}
+
+func TestResultAcksBounded(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.MaxResultAcks = 2
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	var results []models.Result
+	for i := 0; i < 3; i++ {
+		submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+1"})
+		task := fetchTask(t, ts.URL)
+		res := models.Result{ID: task.ID, Result: 2}
+		submitResults(t, ts.URL, res)
+		results = append(results, res)
+	}
+	if ack := submitResults(t, ts.URL, results[2])[0]; ack.Status != http.StatusOK {
+		t.Errorf("Ожидалось сохранённое подтверждение последнего результата, получено %+v", ack)
+	}
+	if ack := submitResults(t, ts.URL, results[0])[0]; ack.Status == http.StatusOK {
+		t.Errorf("Подтверждение самого старого результата должно быть вытеснено, получено %+v", ack)
+	}
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// simulateStarvation моделирует поток приоритетных задач выражения "heavy",
+// на фоне которого выражение "light" ставит одну низкоприоритетную задачу.
+// Перед каждой выдачей поступает новая тяжёлая задача, так что очередь
+// никогда не пустеет. Возвращает число выдач до обслуживания лёгкой задачи
+// или -1, если она так и не была выдана за steps шагов.
+func simulateStarvation(scheduler orchestrator.Scheduler, steps int, tick func()) int {
+	for i := 0; i < 10; i++ {
+		scheduler.Push(&models.Task{ID: fmt.Sprintf("heavy-init-%d", i), ExpressionID: "heavy", OperationTime: 3000, Priority: 10000})
+	}
+	scheduler.Push(&models.Task{ID: "light-1", ExpressionID: "light", OperationTime: 2000, Priority: 2000})
+
+	for step := 1; step <= steps; step++ {
+		scheduler.Push(&models.Task{ID: fmt.Sprintf("heavy-%d", step), ExpressionID: "heavy", OperationTime: 3000, Priority: 10000})
+		task := scheduler.Pop()
+		if task == nil {
+			return -1
+		}
+		if task.ExpressionID == "light" {
+			return step
+		}
+		if tick != nil {
+			tick()
+		}
+	}
+	return -1
+}
+
+func TestPrioritySchedulerFIFOForEqualPriorities(t *testing.T) {
+	scheduler := orchestrator.NewPriorityScheduler()
+	for i := 0; i < 5; i++ {
+		scheduler.Push(&models.Task{ID: fmt.Sprintf("t%d", i), Priority: 1})
+	}
+	scheduler.Push(&models.Task{ID: "urgent", Priority: 5})
+
+	if task := scheduler.Pop(); task.ID != "urgent" {
+		t.Fatalf("Ожидалась задача urgent, получена %s", task.ID)
+	}
+	for i := 0; i < 5; i++ {
+		task := scheduler.Pop()
+		if want := fmt.Sprintf("t%d", i); task.ID != want {
+			t.Errorf("Ожидалась задача %s, получена %s", want, task.ID)
+		}
+	}
+	if scheduler.Pop() != nil || scheduler.Len() != 0 {
+		t.Errorf("Ожидалась пустая очередь")
+	}
+}
+
+func TestPrioritySchedulerStarves(t *testing.T) {
+	if step := simulateStarvation(orchestrator.NewPriorityScheduler(), 1000, nil); step != -1 {
+		t.Errorf("Ожидалось голодание лёгкой задачи при строгих приоритетах, выдана на шаге %d", step)
+	}
+}
+
+func TestFairSchedulerBoundedWait(t *testing.T) {
+	step := simulateStarvation(orchestrator.NewFairScheduler(), 1000, nil)
+	// Лёгкий поток обслуживается не позже, чем одна задача тяжёлого потока.
+	if step == -1 || step > 2 {
+		t.Errorf("Ожидалась выдача лёгкой задачи не позже 2 шага, получено %d", step)
+	}
+}
+
+func TestFairSchedulerAlternatesExpressions(t *testing.T) {
+	scheduler := orchestrator.NewFairScheduler()
+	for i := 0; i < 3; i++ {
+		scheduler.Push(&models.Task{ID: fmt.Sprintf("a%d", i), ExpressionID: "a", OperationTime: 1000, Priority: 9})
+		scheduler.Push(&models.Task{ID: fmt.Sprintf("b%d", i), ExpressionID: "b", OperationTime: 1000, Priority: 1})
+	}
+	counts := map[string]int{}
+	for i := 0; i < 4; i++ {
+		counts[scheduler.Pop().ExpressionID]++
+	}
+	if counts["a"] != 2 || counts["b"] != 2 {
+		t.Errorf("Ожидалось поровну задач обоих выражений, получено %v", counts)
+	}
+	if scheduler.Len() != 2 {
+		t.Errorf("Ожидалось 2 задачи в очереди, получено %d", scheduler.Len())
+	}
+}
+
+func TestAgingSchedulerBoundedWait(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	const rate = 1.0
+	const tickMs = 100
+
+	step := simulateStarvation(orchestrator.NewAgingScheduler(rate, clock), 1000, func() {
+		now = now.Add(tickMs * time.Millisecond)
+	})
+	// Разница приоритетов 8000 компенсируется за 8000 мс ожидания, плюс разбор
+	// 10 задач, стоявших в очереди до лёгкой.
+	bound := int((10000-2000)/rate)/tickMs + 10 + 1
+	if step == -1 || step > bound {
+		t.Errorf("Ожидалась выдача лёгкой задачи не позже шага %d, получено %d", bound, step)
+	}
+}
+
+func TestNewSchedulerUnknownPolicy(t *testing.T) {
+	if _, err := orchestrator.NewScheduler("lottery"); err == nil {
+		t.Errorf("Ожидалась ошибка для неизвестной политики")
+	}
+	for _, policy := range []string{orchestrator.PolicyPriority, orchestrator.PolicyFair, orchestrator.PolicyAging} {
+		if _, err := orchestrator.NewScheduler(policy); err != nil {
+			t.Errorf("Политика %s: неожиданная ошибка %v", policy, err)
+		}
+	}
+}
+
+func TestSchedulerExpressionPriorityFirst(t *testing.T) {
+	for _, policy := range []string{orchestrator.PolicyPriority, orchestrator.PolicyAging, orchestrator.PolicyDeadline} {
+		scheduler, _ := orchestrator.NewScheduler(policy)
+		scheduler.Push(&models.Task{ID: "batch", ExpressionID: "batch", Priority: 20000})
+		scheduler.Push(&models.Task{ID: "ui", ExpressionID: "ui", Priority: 2000, ExpressionPriority: 1})
+		if task := scheduler.Pop(); task.ID != "ui" {
+			t.Errorf("Политика %s: ожидалась задача ui, получена %s", policy, task.ID)
+		}
+	}
+}
+
+func TestDeadlineSchedulerEarliestFirst(t *testing.T) {
+	now := time.Now()
+	late, soon := now.Add(time.Minute), now.Add(time.Second)
+	scheduler := orchestrator.NewDeadlineScheduler()
+	scheduler.Push(&models.Task{ID: "none", Priority: 100})
+	scheduler.Push(&models.Task{ID: "late", Priority: 50, Deadline: &late})
+	scheduler.Push(&models.Task{ID: "soon", Priority: 1, Deadline: &soon})
+
+	for _, want := range []string{"soon", "late", "none"} {
+		if task := scheduler.Pop(); task.ID != want {
+			t.Errorf("Ожидалась задача %s, получена %s", want, task.ID)
+		}
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	for _, policy := range []string{orchestrator.PolicyPriority, orchestrator.PolicyFair, orchestrator.PolicyAging, orchestrator.PolicyDeadline} {
+		scheduler, _ := orchestrator.NewScheduler(policy)
+		for i := 0; i < 3; i++ {
+			scheduler.Push(&models.Task{ID: fmt.Sprintf("a%d", i), ExpressionID: "a", Priority: i})
+			scheduler.Push(&models.Task{ID: fmt.Sprintf("b%d", i), ExpressionID: "b", Priority: i})
+		}
+		removed := scheduler.Remove(func(task *models.Task) bool { return task.ExpressionID == "a" })
+		if removed != 3 || scheduler.Len() != 3 {
+			t.Fatalf("Политика %s: удалено %d, осталось %d", policy, removed, scheduler.Len())
+		}
+		for task := scheduler.Pop(); task != nil; task = scheduler.Pop() {
+			if task.ExpressionID != "b" {
+				t.Errorf("Политика %s: выдана удалённая задача %s", policy, task.ID)
+			}
+		}
+	}
+}
+
+func TestSchedulerPopMatching(t *testing.T) {
+	for _, policy := range []string{orchestrator.PolicyPriority, orchestrator.PolicyFair, orchestrator.PolicyAging, orchestrator.PolicyDeadline} {
+		scheduler, _ := orchestrator.NewScheduler(policy)
+		scheduler.Push(&models.Task{ID: "mul", ExpressionID: "a", Operation: "*", Priority: 9})
+		scheduler.Push(&models.Task{ID: "add1", ExpressionID: "a", Operation: "+", Priority: 5})
+		scheduler.Push(&models.Task{ID: "add2", ExpressionID: "b", Operation: "+", Priority: 1})
+
+		onlyAdd := func(task *models.Task) bool { return task.Operation == "+" }
+		if task := scheduler.PopMatching(onlyAdd); task == nil || task.Operation != "+" {
+			t.Fatalf("Политика %s: ожидалась задача сложения, получена %+v", policy, task)
+		}
+		if task := scheduler.PopMatching(func(task *models.Task) bool { return task.Operation == "/" }); task != nil {
+			t.Errorf("Политика %s: не ожидалась задача, получена %s", policy, task.ID)
+		}
+		if scheduler.Len() != 2 {
+			t.Fatalf("Политика %s: ожидалось 2 задачи в очереди, получено %d", policy, scheduler.Len())
+		}
+		for i := 0; i < 2; i++ {
+			if task := scheduler.Pop(); task == nil {
+				t.Errorf("Политика %s: ожидалась оставшаяся задача", policy)
+			}
+		}
+	}
+}
+
+func TestSchedulerPopMatchingKeepsHeapOrder(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	schedulers := map[string]func() orchestrator.Scheduler{
+		orchestrator.PolicyPriority: func() orchestrator.Scheduler { return orchestrator.NewPriorityScheduler() },
+		orchestrator.PolicyDeadline: func() orchestrator.Scheduler { return orchestrator.NewDeadlineScheduler() },
+		orchestrator.PolicyAging:    func() orchestrator.Scheduler { return orchestrator.NewAgingScheduler(1, clock) },
+	}
+	ops := []string{"+", "-", "*", "/"}
+	for policy, create := range schedulers {
+		matching, all := create(), create()
+		for i := 0; i < 200; i++ {
+			deadline := now.Add(time.Duration(i*7%13) * time.Second)
+			task := &models.Task{ID: strconv.Itoa(i), Operation: ops[i*5%4], Priority: i * 31 % 17, Deadline: &deadline}
+			matching.Push(task)
+			all.Push(task)
+		}
+
+		onlyAdd := func(task *models.Task) bool { return task.Operation == "+" }
+		var want []string
+		for task := all.Pop(); task != nil; task = all.Pop() {
+			if onlyAdd(task) {
+				want = append(want, task.ID)
+			}
+		}
+		for i, id := range want {
+			if task := matching.PopMatching(onlyAdd); task == nil || task.ID != id {
+				t.Fatalf("Политика %s: задача %d — ожидалась %s, получена %+v", policy, i, id, task)
+			}
+		}
+		if matching.Len() != 150 {
+			t.Errorf("Политика %s: ожидалось 150 оставшихся задач, получено %d", policy, matching.Len())
+		}
+	}
+}
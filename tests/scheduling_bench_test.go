@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/parser"
+)
+
+// randomExpression строит случайное выражение заданной глубины.
+func randomExpression(rng *rand.Rand, depth int) string {
+	if depth == 0 || rng.Intn(4) == 0 {
+		return fmt.Sprintf("%d", rng.Intn(9)+1)
+	}
+	ops := []string{"+", "-", "*", "/"}
+	return fmt.Sprintf("(%s%s%s)", randomExpression(rng, depth-1), ops[rng.Intn(len(ops))], randomExpression(rng, depth-1))
+}
+
+// simulateMakespan моделирует вычисление дерева workers агентами, которые
+// всегда берут готовую задачу с наибольшим приоритетом, и возвращает
+// время до получения результата корня в мс.
+func simulateMakespan(root *parser.Node, workers int, priority func(*parser.Node) int) int {
+	type running struct {
+		node   *parser.Node
+		finish int
+	}
+	var ready []*parser.Node
+	var collect func(n *parser.Node)
+	collect = func(n *parser.Node) {
+		if n == nil {
+			return
+		}
+		if n.IsReady() {
+			ready = append(ready, n)
+		}
+		collect(n.Left)
+		collect(n.Right)
+	}
+	collect(root)
+
+	now := 0
+	var active []running
+	for len(ready) > 0 || len(active) > 0 {
+		for len(active) < workers && len(ready) > 0 {
+			best := 0
+			for i := range ready {
+				if priority(ready[i]) > priority(ready[best]) {
+					best = i
+				}
+			}
+			node := ready[best]
+			ready = append(ready[:best], ready[best+1:]...)
+			active = append(active, running{node: node, finish: now + parser.GetOperationTime(node.Op)})
+		}
+		next := 0
+		for i := range active {
+			if active[i].finish < active[next].finish {
+				next = i
+			}
+		}
+		done := active[next]
+		active = append(active[:next], active[next+1:]...)
+		now = done.finish
+		done.node.Computed = true
+		if done.node.Parent != nil && done.node.Parent.IsReady() {
+			ready = append(ready, done.node.Parent)
+		}
+	}
+	return now
+}
+
+func BenchmarkSchedulingHeuristics(b *testing.B) {
+	rng := rand.New(rand.NewSource(42))
+	expressions := make([]string, 200)
+	for i := range expressions {
+		expressions[i] = randomExpression(rng, 6)
+	}
+
+	heuristics := map[string]func(*parser.Node) int{
+		"operator": func(n *parser.Node) int {
+			return parser.GetOperationPriority(n.Op)
+		},
+		"critical_path": parser.CriticalPathTime,
+	}
+	for _, name := range []string{"operator", "critical_path"} {
+		priority := heuristics[name]
+		b.Run(name, func(b *testing.B) {
+			total := 0
+			for i := 0; i < b.N; i++ {
+				for j, exprStr := range expressions {
+					ast, err := parser.ParseExpression(exprStr)
+					if err != nil {
+						b.Fatalf("Не удалось распарсить выражение: %v", err)
+					}
+					parser.AssignIDs(fmt.Sprintf("bench%d", j), ast)
+					total += simulateMakespan(ast, 2, priority)
+				}
+			}
+			b.ReportMetric(float64(total)/float64(b.N*len(expressions)), "ms/expr")
+		})
+	}
+}
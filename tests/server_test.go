@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -111,12 +112,15 @@ func TestExpressionsEndpoint(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("Ожидался статус OK, получен %d", resp.StatusCode)
 	}
-	var listRes map[string][]models.Expression
+	var listRes struct {
+		Expressions []models.Expression `json:"expressions"`
+		Total       int                 `json:"total"`
+	}
 	err = json.NewDecoder(resp.Body).Decode(&listRes)
 	if err != nil {
 		t.Fatalf("Не удалось декодировать список выражений: %v", err)
 	}
-	expressions := listRes["expressions"]
+	expressions := listRes.Expressions
 	if len(expressions) != 0 {
 		t.Errorf("Ожидалось 0 выражений, получено %d", len(expressions))
 	}
@@ -151,7 +155,7 @@ func TestExpressionsEndpoint(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Не удалось декодировать список выражений: %v", err)
 	}
-	expressions = listRes["expressions"]
+	expressions = listRes.Expressions
 	if len(expressions) != 1 {
 		t.Errorf("Ожидалось 1 выражение, получено %d", len(expressions))
 	}
@@ -250,3 +254,222 @@ func TestDivisionByZeroEndpoint(t *testing.T) {
 		t.Errorf("Ожидался статус 'error', получен '%s'", exprData.Status)
 	}
 }
+
+func TestExpressionPriorityEndpoint(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	for _, payload := range []map[string]interface{}{
+		{"expression": "1+2"},
+		{"expression": "3+4", "priority": 10},
+	} {
+		data, _ := json.Marshal(payload)
+		resp, err := http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Ожидался статус 201 Created, получен %d", resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/internal/task")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	var taskRes map[string]models.Task
+	if err := json.NewDecoder(resp.Body).Decode(&taskRes); err != nil {
+		t.Fatalf("Не удалось декодировать ответ задачи: %v", err)
+	}
+	if task := taskRes["task"]; task.Arg1 != 3 || task.ExpressionPriority != 10 {
+		t.Errorf("Ожидалась задача приоритетного выражения, получена %+v", task)
+	}
+
+	for _, priority := range []int64{1 << 40, -(1 << 40)} {
+		data, _ := json.Marshal(map[string]interface{}{"expression": "5+6", "priority": priority})
+		resp, err := http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+		}
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Ожидался статус 422 для приоритета %d, получен %d", priority, resp.StatusCode)
+		}
+	}
+}
+
+func TestExpressionDeadlineEndpoint(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	payload := map[string]interface{}{
+		"expression": "2*3",
+		"deadline":   time.Now().Add(50 * time.Millisecond),
+	}
+	data, _ := json.Marshal(payload)
+	resp, err := http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201 Created, получен %d", resp.StatusCode)
+	}
+	var res map[string]string
+	json.NewDecoder(resp.Body).Decode(&res)
+	exprID := res["id"]
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err = http.Get(ts.URL + "/internal/task")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Ожидался статус 404 для просроченной задачи, получен %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/expressions/" + exprID)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе выражения по ID: %v", err)
+	}
+	var exprRes map[string]models.Expression
+	json.NewDecoder(resp.Body).Decode(&exprRes)
+	if status := exprRes["expression"].Status; status != "timeout" {
+		t.Errorf("Ожидался статус 'timeout', получен '%s'", status)
+	}
+
+	payload["deadline"] = time.Now().Add(-time.Second)
+	data, _ = json.Marshal(payload)
+	resp, err = http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался статус 422 для истёкшего срока, получен %d", resp.StatusCode)
+	}
+}
+
+func TestWatchdogExpiresExpressions(t *testing.T) {
+	server := orchestrator.NewServer()
+	server.MaxEvaluationTime = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.RunWatchdog(ctx, 10*time.Millisecond)
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	ids := make([]string, 0, 2)
+	for _, payload := range []map[string]string{
+		{"expression": "1+2*3", "timeout": "50ms"},
+		{"expression": "4-1"},
+	} {
+		data, _ := json.Marshal(payload)
+		resp, err := http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Ожидался статус 201 Created, получен %d", resp.StatusCode)
+		}
+		var res map[string]string
+		json.NewDecoder(resp.Body).Decode(&res)
+		ids = append(ids, res["id"])
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	for i, want := range []models.ExpressionStatus{models.StatusTimeout, models.StatusPending} {
+		resp, err := http.Get(ts.URL + "/api/v1/expressions/" + ids[i])
+		if err != nil {
+			t.Fatalf("Ошибка при запросе выражения по ID: %v", err)
+		}
+		var exprRes map[string]models.Expression
+		json.NewDecoder(resp.Body).Decode(&exprRes)
+		if status := exprRes["expression"].Status; status != want {
+			t.Errorf("Выражение %s: ожидался статус '%s', получен '%s'", ids[i], want, status)
+		}
+	}
+
+	server.QueueMutex.Lock()
+	queued := server.TaskQueue.Len()
+	server.QueueMutex.Unlock()
+	if queued != 1 {
+		t.Errorf("Ожидалась 1 задача в очереди после таймаута, получено %d", queued)
+	}
+
+	// Ограничение времени не подменяет срок клиента и не влияет на планирование.
+	resp, err := http.Get(ts.URL + "/api/v1/expressions/" + ids[1])
+	if err != nil {
+		t.Fatalf("Ошибка при запросе выражения по ID: %v", err)
+	}
+	var exprRes map[string]models.Expression
+	json.NewDecoder(resp.Body).Decode(&exprRes)
+	if expr := exprRes["expression"]; expr.Deadline != nil || expr.TimeoutAt == nil {
+		t.Errorf("Ожидалось ограничение времени без срока клиента, получено %+v", expr)
+	}
+	if task := fetchTask(t, ts.URL); task.Deadline != nil {
+		t.Errorf("Задача не должна получать срок из ограничения времени: %+v", task)
+	}
+}
+
+func TestLongPollingTaskEndpoint(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/internal/task?wait=50ms")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Ожидался статус 404 после ожидания, получен %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Запрос вернулся раньше окончания ожидания: %v", elapsed)
+	}
+
+	type fetchResult struct {
+		status int
+		task   models.Task
+		err    error
+	}
+	done := make(chan fetchResult, 1)
+	go func() {
+		resp, err := http.Get(ts.URL + "/internal/task?wait=5s")
+		if err != nil {
+			done <- fetchResult{err: err}
+			return
+		}
+		var taskRes map[string]models.Task
+		json.NewDecoder(resp.Body).Decode(&taskRes)
+		done <- fetchResult{status: resp.StatusCode, task: taskRes["task"]}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	start = time.Now()
+	data, _ := json.Marshal(map[string]string{"expression": "6/3"})
+	resp, err = http.Post(ts.URL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201 Created, получен %d", resp.StatusCode)
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("Ошибка при ожидании задачи: %v", res.err)
+		}
+		if res.status != http.StatusOK || res.task.Operation != "/" {
+			t.Fatalf("Ожидалась задача деления, получен статус %d и задача %+v", res.status, res.task)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Задача доставлена слишком поздно: %v", elapsed)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Ожидающий агент не получил задачу")
+	}
+}
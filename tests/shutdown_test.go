@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func TestShutdownDrainsDispatchedTasks(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*4"})
+	task := fetchTask(t, ts.URL)
+
+	server.BeginShutdown()
+	resp := postJSON(t, ts.URL+"/api/v1/calculate", map[string]string{"expression": "1+1"}, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался статус 503 для нового выражения при остановке, получен %d", resp.StatusCode)
+	}
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/internal/task?wait=10s")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || time.Since(start) > time.Second {
+		t.Errorf("Ожидался немедленный статус 503 при остановке, получен %d через %s", resp.StatusCode, time.Since(start))
+	}
+
+	reports := make(chan orchestrator.ShutdownReport, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		reports <- server.Drain(ctx)
+	}()
+	select {
+	case <-reports:
+		t.Fatal("Drain завершился, не дождавшись результата выданной задачи")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	postJSON(t, ts.URL+"/internal/task/result", models.Result{ID: task.ID, Result: 3}, nil).Body.Close()
+	report := <-reports
+	if report.DispatchedTasks != 0 || report.PendingExpressions != 1 || report.QueuedTasks != 1 {
+		t.Errorf("Неверный отчёт об остановке: %+v", report)
+	}
+}
+
+func TestWorkersFinishCurrentTaskOnCancel(t *testing.T) {
+	t.Setenv("TIME_ADDITION_MS", "200")
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+3"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := agent.StartWorkers(ctx, 2, agent.NewHTTPTransport(ts.URL, "shutdown-agent", nil, time.Second))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Report().DispatchedTasks == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Рабочие не остановились после отмены контекста")
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "completed" || *expr.Result != 5 {
+		t.Errorf("Ожидалось, что начатая задача будет доведена до конца, получено %+v", expr)
+	}
+}
+
+func TestAgentDeregisterRequeuesTasks(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	postJSON(t, ts.URL+"/internal/agents/register", models.AgentInfo{ID: "leaving", ComputingPower: 1}, nil).Body.Close()
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "4-1"})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/internal/task", nil)
+	req.Header.Set(models.AgentIDHeader, "leaving")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Не удалось получить задачу: %v", err)
+	}
+	resp.Body.Close()
+
+	resp = postJSON(t, ts.URL+"/internal/agents/deregister", map[string]string{"id": "leaving"}, nil)
+	defer resp.Body.Close()
+	var res map[string]int
+	json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != http.StatusOK || res["requeued"] != 1 {
+		t.Fatalf("Ожидался возврат 1 задачи, получено %v (статус %d)", res, resp.StatusCode)
+	}
+	if task := fetchTask(t, ts.URL); task.Operation != "-" {
+		t.Errorf("Ожидалась возвращённая задача, получено %+v", task)
+	}
+	if agents := listAgents(t, ts.URL+"/internal/agents"); agents[0].Status != models.AgentLeft {
+		t.Errorf("Ожидался статус %s, получено %+v", models.AgentLeft, agents[0])
+	}
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// computeResult вычисляет задачу без поддерева так же, как агент.
+func computeResult(task models.Task) models.Result {
+	var value float64
+	switch task.Operation {
+	case "+":
+		value = task.Arg1 + task.Arg2
+	case "-":
+		value = task.Arg1 - task.Arg2
+	case "*":
+		value = task.Arg1 * task.Arg2
+	case "/":
+		value = task.Arg1 / task.Arg2
+	}
+	return models.Result{ID: task.ID, Result: value}
+}
+
+// drainTasks выполняет все задачи сервера, пока очередь не опустеет, и
+// возвращает число выполненных задач.
+func drainTasks(t *testing.T, baseURL string) int {
+	t.Helper()
+	total := 0
+	for {
+		tasks, status := fetchTasks(t, baseURL, 10)
+		if status != http.StatusOK {
+			return total
+		}
+		results := make([]models.Result, len(tasks))
+		for i, task := range tasks {
+			results[i] = computeResult(task)
+		}
+		submitResults(t, baseURL, results...)
+		total += len(tasks)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	first := orchestrator.NewServer()
+	ts := httptest.NewServer(first.Router)
+	mulID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1+2)*(3+4)"})
+	subID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "5-1"})
+
+	tasks, _ := fetchTasks(t, ts.URL, 2)
+	if len(tasks) != 2 {
+		t.Fatalf("Ожидалось 2 задачи, получено %d", len(tasks))
+	}
+	answered := computeResult(tasks[0])
+	ack := submitResults(t, ts.URL, answered)[0]
+	if err := first.SaveSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при сохранении снимка: %v", err)
+	}
+	ts.Close()
+
+	second := orchestrator.NewServer()
+	if err := second.LoadSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при восстановлении снимка: %v", err)
+	}
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+	if listed := listExpressions(t, ts.URL); len(listed) != 2 {
+		t.Errorf("Ожидалось 2 выражения в списке после восстановления, получено %d", len(listed))
+	}
+
+	// Повтор уже принятого результата получает прежнее подтверждение.
+	if dup := submitResults(t, ts.URL, answered)[0]; dup != ack {
+		t.Errorf("Ожидалось прежнее подтверждение %+v, получено %+v", ack, dup)
+	}
+	// Остались задача из очереди и задача, выданная агенту без ответа;
+	// затем — умножение, если было выполнено одно из сложений.
+	report := second.Report()
+	if report.QueuedTasks != 2 || report.PendingExpressions != 2 {
+		t.Errorf("Неверное восстановленное состояние: %+v", report)
+	}
+	drainTasks(t, ts.URL)
+
+	for id, want := range map[string]float64{mulID: 21, subID: 4} {
+		if expr := getExpression(t, ts.URL, id); expr.Status != "completed" || *expr.Result != want {
+			t.Errorf("Выражение %s: ожидался результат %v, получено %+v", id, want, expr)
+		}
+	}
+}
+
+func TestSnapshotReschedulesLostTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	first := orchestrator.NewServer()
+	ts := httptest.NewServer(first.Router)
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(2+2)*(3+3)"})
+	ts.Close()
+	if err := first.SaveSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при сохранении снимка: %v", err)
+	}
+
+	// Имитируем задачу, потерянную между очередью и агентом: узлы отмечены
+	// запланированными, но самих задач в снимке нет.
+	data, _ := os.ReadFile(path)
+	var raw map[string]interface{}
+	json.Unmarshal(data, &raw)
+	raw["queue"] = nil
+	data, _ = json.Marshal(raw)
+	os.WriteFile(path, data, 0o644)
+
+	second := orchestrator.NewServer()
+	if err := second.LoadSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при восстановлении снимка: %v", err)
+	}
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+	if n := drainTasks(t, ts.URL); n != 3 {
+		t.Errorf("Ожидалось 3 задачи после восстановления, выполнено %d", n)
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "completed" || *expr.Result != 24 {
+		t.Errorf("Ожидался результат 24, получено %+v", expr)
+	}
+}
+
+func TestSnapshotAcceptsLateResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	first := orchestrator.NewServer()
+	ts := httptest.NewServer(first.Router)
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+3"})
+	task := agentTask(t, ts.URL, "worker")
+	ts.Close()
+	if err := first.SaveSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при сохранении снимка: %v", err)
+	}
+
+	second := orchestrator.NewServer()
+	if err := second.LoadSnapshot(path); err != nil {
+		t.Fatalf("Ошибка при восстановлении снимка: %v", err)
+	}
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+
+	// Агент досчитал задачу во время перезапуска оркестратора.
+	if ack := agentResult(t, ts.URL, "worker", computeResult(task)); ack.Status != http.StatusOK {
+		t.Fatalf("Ожидался статус OK для результата, выданной до перезапуска задачи, получено %+v", ack)
+	}
+	if ack := agentResult(t, ts.URL, "stranger", computeResult(task)); ack.Status != http.StatusOK {
+		t.Errorf("Ожидалось сохранённое подтверждение для повторного результата, получено %+v", ack)
+	}
+	if report := second.Report(); report.QueuedTasks != 0 {
+		t.Errorf("Возвращённая в очередь копия задачи не удалена: %+v", report)
+	}
+	if expr := getExpression(t, ts.URL, exprID); expr.Status != "completed" || *expr.Result != 5 {
+		t.Errorf("Ожидался результат 5, получено %+v", expr)
+	}
+}
+
+func TestLoadSnapshotMissingFile(t *testing.T) {
+	server := orchestrator.NewServer()
+	if err := server.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Отсутствующий снимок не должен быть ошибкой: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func TestStatusTransitionTable(t *testing.T) {
+	allowed := map[models.ExpressionStatus][]models.ExpressionStatus{
+		models.StatusPending:    {models.StatusInProgress, models.StatusError, models.StatusCancelled, models.StatusTimeout},
+		models.StatusInProgress: {models.StatusCompleted, models.StatusError, models.StatusCancelled, models.StatusTimeout},
+	}
+	for _, from := range models.Statuses {
+		for _, to := range models.Statuses {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			if got := models.CanTransition(from, to); got != want {
+				t.Errorf("Переход %s → %s: ожидалось %v, получено %v", from, to, want, got)
+			}
+		}
+		if terminal := len(allowed[from]) == 0; from.IsTerminal() != terminal {
+			t.Errorf("Статус %s: ожидалось IsTerminal() = %v", from, terminal)
+		}
+		if !from.Valid() {
+			t.Errorf("Статус %s должен быть допустимым", from)
+		}
+	}
+	if models.ExpressionStatus("done").Valid() || models.ExpressionStatus("done").IsTerminal() {
+		t.Errorf("Неизвестный статус не должен считаться допустимым")
+	}
+	if models.CanTransition("done", models.StatusPending) {
+		t.Errorf("Из неизвестного статуса переходов быть не должно")
+	}
+}
+
+func TestExpressionTransition(t *testing.T) {
+	expr := &models.Expression{ID: "e", Status: models.StatusPending}
+	if err := expr.Transition(models.StatusCompleted); err == nil || expr.Status != models.StatusPending {
+		t.Errorf("Переход pending → completed должен быть отклонён, статус %s", expr.Status)
+	}
+	for _, to := range []models.ExpressionStatus{models.StatusInProgress, models.StatusError} {
+		if err := expr.Transition(to); err != nil {
+			t.Fatalf("Переход в %s отклонён: %v", to, err)
+		}
+	}
+	for _, to := range models.Statuses {
+		if err := expr.Transition(to); err == nil || expr.Status != models.StatusError {
+			t.Errorf("Переход из завершающего статуса в %s должен быть отклонён", to)
+		}
+	}
+}
+
+func TestLateResultDoesNotReviveErroredExpression(t *testing.T) {
+	ts := httptest.NewServer(orchestrator.NewServer().Router)
+	defer ts.Close()
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(1/0)*(3+4)"})
+	tasks, _ := fetchTasks(t, ts.URL, 2)
+	if len(tasks) != 2 {
+		t.Fatalf("Ожидалось 2 задачи, получено %d", len(tasks))
+	}
+	failed, late := tasks[0], tasks[1]
+	if failed.Operation != "/" {
+		failed, late = late, failed
+	}
+	submitResults(t, ts.URL, models.Result{ID: failed.ID, Error: "деление на ноль"})
+	ack := submitResults(t, ts.URL, computeResult(late))[0]
+	if ack.Status != http.StatusConflict {
+		t.Errorf("Ожидался статус 409 для позднего результата, получен %d", ack.Status)
+	}
+	if expr := getExpression(t, ts.URL, id); expr.Status != models.StatusError || expr.Result != nil {
+		t.Errorf("Выражение с ошибкой изменило состояние: %+v", expr)
+	}
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/agent"
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+func submitExpression(t testing.TB, baseURL string, payload map[string]interface{}) string {
+	t.Helper()
+	data, _ := json.Marshal(payload)
+	resp, err := http.Post(baseURL+"/api/v1/calculate", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Ошибка при вызове /api/v1/calculate: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201 Created, получен %d", resp.StatusCode)
+	}
+	var res map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("Не удалось декодировать ответ: %v", err)
+	}
+	return res["id"]
+}
+
+func getExpression(t *testing.T, baseURL, id string) models.Expression {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/expressions/" + id)
+	if err != nil {
+		t.Fatalf("Ошибка при запросе выражения по ID: %v", err)
+	}
+	defer resp.Body.Close()
+	var exprRes map[string]models.Expression
+	if err := json.NewDecoder(resp.Body).Decode(&exprRes); err != nil {
+		t.Fatalf("Не удалось декодировать ответ выражения: %v", err)
+	}
+	return exprRes["expression"]
+}
+
+// recvTask получает задачу из потока, не дожидаясь её дольше timeout.
+func recvTask(t *testing.T, conn *agent.StreamConn, timeout time.Duration) *models.Task {
+	t.Helper()
+	type received struct {
+		task *models.Task
+		err  error
+	}
+	ch := make(chan received, 1)
+	go func() {
+		task, err := conn.Recv()
+		ch <- received{task, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("Ошибка при получении задачи из потока: %v", r.err)
+		}
+		return r.task
+	case <-time.After(timeout):
+		t.Fatalf("Задача не получена за %v", timeout)
+	}
+	return nil
+}
+
+func TestTaskStreamEndpoint(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	conn, err := agent.DialStream(ts.URL, "stream-agent", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось открыть поток задач: %v", err)
+	}
+	defer conn.Close()
+
+	exprID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1+2*3"})
+
+	task := recvTask(t, conn, time.Second)
+	if task.Operation != "*" {
+		t.Fatalf("Ожидалась операция '*', получена %s", task.Operation)
+	}
+	if err := conn.Send(models.Result{ID: task.ID, Result: 6}); err != nil {
+		t.Fatalf("Ошибка при отправке результата: %v", err)
+	}
+
+	task = recvTask(t, conn, time.Second)
+	if task.Operation != "+" || task.Arg2 != 6 {
+		t.Fatalf("Ожидалась задача 1+6, получена %+v", task)
+	}
+	if err := conn.Send(models.Result{ID: task.ID, Result: 7}); err != nil {
+		t.Fatalf("Ошибка при отправке результата: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		expr := getExpression(t, ts.URL, exprID)
+		if expr.Status == "completed" {
+			if expr.Result == nil || *expr.Result != 7 {
+				t.Errorf("Ожидался результат 7, получено %v", expr.Result)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Выражение не вычислено, статус %s", expr.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTaskStreamRequeuesOnDisconnect(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	conn, err := agent.DialStream(ts.URL, "stream-agent", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось открыть поток задач: %v", err)
+	}
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "8-5"})
+	task := recvTask(t, conn, time.Second)
+	conn.Close()
+
+	resp, err := http.Get(ts.URL + "/internal/task?wait=1s")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе задачи: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ожидался возврат задачи в очередь, получен статус %d", resp.StatusCode)
+	}
+	var taskRes map[string]models.Task
+	json.NewDecoder(resp.Body).Decode(&taskRes)
+	if taskRes["task"].ID != task.ID {
+		t.Errorf("Ожидалась задача %s, получена %s", task.ID, taskRes["task"].ID)
+	}
+}
+
+func TestTaskStreamKeepsTaskAfterForeignResult(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	conn, err := agent.DialStream(ts.URL, "stream-agent", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось открыть поток задач: %v", err)
+	}
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "8-5"})
+	submitExpression(t, ts.URL, map[string]interface{}{"expression": "2*3"})
+	task := recvTask(t, conn, time.Second)
+	if ack := agentResult(t, ts.URL, "stranger", models.Result{ID: task.ID, Result: 1}); ack.Status != http.StatusPreconditionFailed {
+		t.Fatalf("Ожидался статус 412 для результата другого агента, получено %+v", ack)
+	}
+
+	// Отклонённый результат не освобождает место: вторая задача не выдаётся.
+	next := make(chan *models.Task, 1)
+	go func() {
+		task, _ := conn.Recv()
+		next <- task
+	}()
+	select {
+	case extra := <-next:
+		if extra != nil {
+			t.Fatalf("Агенту с ёмкостью 1 выдана вторая задача: %+v", extra)
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		report := server.Report()
+		if report.DispatchedTasks == 0 && report.QueuedTasks == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Задача потока не возвращена в очередь после разрыва: %+v", report)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTaskStreamBehindPathPrefix(t *testing.T) {
+	server := orchestrator.NewServer()
+	mux := http.NewServeMux()
+	mux.Handle("/calc/", http.StripPrefix("/calc", server.Router))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	conn, err := agent.DialStream(ts.URL+"/calc/", "stream-agent", nil, 1)
+	if err != nil {
+		t.Fatalf("Не удалось открыть поток задач по адресу с префиксом: %v", err)
+	}
+	defer conn.Close()
+	submitExpression(t, ts.URL+"/calc", map[string]interface{}{"expression": "2*5"})
+	if task := recvTask(t, conn, time.Second); task.Operation != "*" {
+		t.Errorf("Ожидалась операция '*', получена %+v", task)
+	}
+}
+
+func TestTaskStreamRequiresUpgrade(t *testing.T) {
+	server := orchestrator.NewServer()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/internal/task/stream")
+	if err != nil {
+		t.Fatalf("Ошибка при запросе потока: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Ожидался статус 426, получен %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,335 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+	"github.com/Diverstt/Calculator_Yandex/internal/storage"
+)
+
+// walOp — i-я операция сценария: выражения перезаписываются по кругу,
+// поэтому состояние после каждого префикса операций различается.
+func walOp(i int) *models.Expression {
+	return resultExpr(fmt.Sprintf("e%d", i%5), float64(i))
+}
+
+func resultExpr(id string, result float64) *models.Expression {
+	return &models.Expression{ID: id, Status: "completed", Result: &result}
+}
+
+// stateAfter возвращает ожидаемое содержимое хранилища после первых n операций.
+func stateAfter(n int) map[string]float64 {
+	state := make(map[string]float64)
+	for i := 0; i < n; i++ {
+		expr := walOp(i)
+		state[expr.ID] = *expr.Result
+	}
+	return state
+}
+
+func storeState(s *storage.MemoryStore) map[string]float64 {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	state := make(map[string]float64)
+	for id, expr := range s.Expressions {
+		if expr.Result != nil {
+			state[id] = *expr.Result
+		}
+	}
+	return state
+}
+
+func sameState(a, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, v := range a {
+		if w, ok := b[id]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPrefix возвращает длину префикса операций, которому соответствует
+// состояние, начиная поиск с from, или -1.
+func matchPrefix(state map[string]float64, from, total int) int {
+	for n := from; n <= total; n++ {
+		if sameState(state, stateAfter(n)) {
+			return n
+		}
+	}
+	return -1
+}
+
+func writeOps(t *testing.T, dir string, from, to, compactEvery int) {
+	t.Helper()
+	store, err := storage.OpenDurable(dir, compactEvery)
+	if err != nil {
+		t.Fatalf("Не удалось открыть хранилище: %v", err)
+	}
+	for i := from; i < to; i++ {
+		if err := store.SaveExpression(walOp(i).ID, walOp(i)); err != nil {
+			t.Fatalf("Ошибка записи: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия хранилища: %v", err)
+	}
+}
+
+// crashCopy копирует каталог хранилища, обрезая журнал до offset байт, —
+// так выглядит диск после сбоя посреди записи.
+func crashCopy(t *testing.T, src string, wal []byte, offset int) string {
+	t.Helper()
+	dst := t.TempDir()
+	if snap, err := os.ReadFile(filepath.Join(src, "snapshot.json")); err == nil {
+		if err := os.WriteFile(filepath.Join(dst, "snapshot.json"), snap, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dst, "wal.log"), wal[:offset], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// checkCrashOffsets обрезает журнал на каждом байте и проверяет, что
+// восстановленное состояние — префикс операций, не убывающий с ростом
+// смещения, что при целом журнале восстанавливаются все total операций и
+// что после восстановления в хранилище можно продолжать писать.
+func checkCrashOffsets(t *testing.T, dir string, base, total int) {
+	t.Helper()
+	wal, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := base
+	for offset := 0; offset <= len(wal); offset++ {
+		crashed := crashCopy(t, dir, wal, offset)
+		store, err := storage.OpenDurable(crashed, 1000)
+		if err != nil {
+			t.Fatalf("Смещение %d: восстановление не удалось: %v", offset, err)
+		}
+		n := matchPrefix(storeState(store), prev, total)
+		if n < 0 {
+			t.Fatalf("Смещение %d: состояние %v не является префиксом операций", offset, storeState(store))
+		}
+		prev = n
+
+		extra := resultExpr("after-crash", 1)
+		if err := store.SaveExpression(extra.ID, extra); err != nil {
+			t.Fatalf("Смещение %d: запись после восстановления: %v", offset, err)
+		}
+		store.Close()
+		reopened, err := storage.OpenDurable(crashed, 1000)
+		if err != nil {
+			t.Fatalf("Смещение %d: повторное открытие: %v", offset, err)
+		}
+		state := storeState(reopened)
+		reopened.Close()
+		if _, ok := state["after-crash"]; !ok {
+			t.Fatalf("Смещение %d: потеряна запись, сделанная после восстановления", offset)
+		}
+		delete(state, "after-crash")
+		if !sameState(state, stateAfter(n)) {
+			t.Fatalf("Смещение %d: после повторного открытия состояние изменилось", offset)
+		}
+	}
+	if prev != total {
+		t.Fatalf("Из целого журнала восстановлено %d операций из %d", prev, total)
+	}
+}
+
+func TestDurableStoreCrashAtAnyOffset(t *testing.T) {
+	dir := t.TempDir()
+	writeOps(t, dir, 0, 12, 1000)
+	checkCrashOffsets(t, dir, 0, 12)
+}
+
+func TestDurableStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	writeOps(t, dir, 0, 13, 5)
+	if _, err := os.Stat(filepath.Join(dir, "snapshot.json")); err != nil {
+		t.Fatalf("Снимок не создан: %v", err)
+	}
+
+	store, err := storage.OpenDurable(dir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := storeState(store); !sameState(got, stateAfter(13)) {
+		t.Errorf("После сворачивания восстановлено %v, ожидалось %v", got, stateAfter(13))
+	}
+	store.Close()
+
+	// В журнале остались только записи после последнего снимка.
+	checkCrashOffsets(t, dir, 10, 13)
+}
+
+func TestDurableStoreCorruptedTail(t *testing.T) {
+	dir := t.TempDir()
+	writeOps(t, dir, 0, 6, 1000)
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal[len(wal)-2] ^= 0xff
+	if err := os.WriteFile(path, wal, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.OpenDurable(dir, 1000)
+	if err != nil {
+		t.Fatalf("Восстановление не удалось: %v", err)
+	}
+	defer store.Close()
+	if got := storeState(store); !sameState(got, stateAfter(5)) {
+		t.Errorf("Запись с неверной контрольной суммой не отброшена: %v", got)
+	}
+}
+
+func TestDurableStoreCorruptedMiddleRecord(t *testing.T) {
+	dir := t.TempDir()
+	writeOps(t, dir, 0, 6, 1000)
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Заголовок записи: 4 байта длины данных и 4 байта контрольной суммы.
+	offset := 0
+	for i := 0; i < 3; i++ {
+		offset += 8 + int(binary.LittleEndian.Uint32(wal[offset:]))
+	}
+	wal[offset+8] ^= 0xff
+	if err := os.WriteFile(path, wal, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if store, err := storage.OpenDurable(dir, 1000); err == nil {
+		store.Close()
+		t.Fatalf("Ожидалась ошибка для повреждённой записи в середине журнала")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, wal) {
+		t.Errorf("Журнал с повреждённой записью в середине не должен усекаться")
+	}
+}
+
+func TestDurableStoreCorruptedMiddleLength(t *testing.T) {
+	for _, length := range []uint32{0xffffffff, 16<<20 + 1, 200} {
+		dir := t.TempDir()
+		writeOps(t, dir, 0, 6, 1000)
+		path := filepath.Join(dir, "wal.log")
+		wal, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := 0
+		for i := 0; i < 3; i++ {
+			offset += 8 + int(binary.LittleEndian.Uint32(wal[offset:]))
+		}
+		binary.LittleEndian.PutUint32(wal[offset:], length)
+		if err := os.WriteFile(path, wal, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if store, err := storage.OpenDurable(dir, 1000); err == nil {
+			store.Close()
+			t.Fatalf("Ожидалась ошибка для длины %d в заголовке записи в середине журнала", length)
+		}
+		if after, _ := os.ReadFile(path); !bytes.Equal(after, wal) {
+			t.Errorf("Журнал с неверной длиной записи %d в середине не должен усекаться", length)
+		}
+	}
+}
+
+func TestDurableStoreConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.OpenDurable(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			expr := resultExpr(fmt.Sprintf("c%d", i), float64(i))
+			if err := store.SaveExpression(expr.ID, expr); err != nil {
+				t.Errorf("Ошибка записи: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	store.Close()
+
+	reopened, err := storage.OpenDurable(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for i := 0; i < 100; i++ {
+		expr, ok := reopened.GetExpression(fmt.Sprintf("c%d", i))
+		if !ok || *expr.Result != float64(i) {
+			t.Fatalf("Выражение c%d не восстановлено", i)
+		}
+	}
+}
+
+func TestStorageModeFromConfig(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "durable")
+	t.Setenv("STORAGE_DIR", t.TempDir())
+	store, err := storage.Open(storage.ConfigFromEnv())
+	if err != nil {
+		t.Fatalf("Не удалось открыть хранилище: %v", err)
+	}
+	store.Close()
+
+	if _, err := storage.Open(storage.Config{Mode: "tape"}); err == nil {
+		t.Errorf("Ожидалась ошибка для неизвестного режима")
+	}
+}
+
+func TestServerDurableStore(t *testing.T) {
+	cfg := storage.Config{Mode: storage.ModeDurable, Dir: t.TempDir(), CompactEvery: 1000}
+
+	first := orchestrator.NewServer()
+	if err := first.OpenStore(cfg); err != nil {
+		t.Fatalf("Не удалось открыть хранилище: %v", err)
+	}
+	ts := httptest.NewServer(first.Router)
+	doneID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+3"})
+	drainTasks(t, ts.URL)
+	pendingID := submitExpression(t, ts.URL, map[string]interface{}{"expression": "(4*5)+1"})
+	fetchTask(t, ts.URL)
+	ts.Close()
+	first.CloseStore()
+
+	second := orchestrator.NewServer()
+	if err := second.OpenStore(cfg); err != nil {
+		t.Fatalf("Не удалось восстановить хранилище: %v", err)
+	}
+	defer second.CloseStore()
+	ts = httptest.NewServer(second.Router)
+	defer ts.Close()
+
+	if expr := getExpression(t, ts.URL, doneID); expr.Status != models.StatusCompleted || *expr.Result != 5 {
+		t.Errorf("Ожидался восстановленный результат 5, получено %+v", expr)
+	}
+	if n := drainTasks(t, ts.URL); n != 2 {
+		t.Errorf("Незавершённое выражение должно вычисляться заново: выполнено задач %d", n)
+	}
+	if expr := getExpression(t, ts.URL, pendingID); expr.Status != models.StatusCompleted || *expr.Result != 21 {
+		t.Errorf("Ожидался результат 21, получено %+v", expr)
+	}
+}
@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Diverstt/Calculator_Yandex/internal/models"
+	"github.com/Diverstt/Calculator_Yandex/internal/orchestrator"
+)
+
+// webhookReceiver отвечает на первые fail запросов статусом failStatus, а
+// затем — 200, запоминая полученные уведомления.
+type webhookReceiver struct {
+	mu         sync.Mutex
+	fail       int
+	failStatus int
+	calls      int
+	bodies     [][]byte
+	signatures []string
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.calls++
+	if rcv.calls <= rcv.fail {
+		w.WriteHeader(rcv.failStatus)
+		return
+	}
+	rcv.bodies = append(rcv.bodies, body)
+	rcv.signatures = append(rcv.signatures, r.Header.Get(orchestrator.WebhookSignatureHeader))
+}
+
+func newWebhookServer(t *testing.T, attempts int) (*orchestrator.Server, *httptest.Server) {
+	server := orchestrator.NewServer()
+	server.WebhookSecret = "secret"
+	server.WebhookMaxAttempts = attempts
+	server.WebhookRetryBase = time.Millisecond
+	server.WebhookRetryMax = 5 * time.Millisecond
+	// Получатели в тестах слушают loopback-адрес.
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	server.WebhookAllowedNets = []*net.IPNet{loopback}
+	ts := httptest.NewServer(server.Router)
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// waitWebhook ждёт, пока отправка уведомления завершится.
+func waitWebhook(t *testing.T, baseURL, id string) *models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		expr := getExpression(t, baseURL, id)
+		if expr.Webhook != nil && expr.Webhook.Status != models.WebhookPending {
+			return expr.Webhook
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Отправка уведомления о выражении %s не завершилась", id)
+	return nil
+}
+
+func TestWebhookDeliveredWithRetries(t *testing.T) {
+	rcv := &webhookReceiver{fail: 2, failStatus: http.StatusServiceUnavailable}
+	receiver := httptest.NewServer(rcv)
+	defer receiver.Close()
+	_, ts := newWebhookServer(t, 5)
+
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2*21", "callback_url": receiver.URL})
+	if expr := getExpression(t, ts.URL, id); expr.CallbackURL != receiver.URL || expr.Webhook != nil {
+		t.Fatalf("До завершения уведомление не отправляется: %+v", expr)
+	}
+	drainTasks(t, ts.URL)
+
+	delivery := waitWebhook(t, ts.URL, id)
+	if delivery.Status != models.WebhookDelivered || delivery.Attempts != 3 || delivery.DeliveredAt == nil {
+		t.Errorf("Неверное состояние доставки: %+v", delivery)
+	}
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if len(rcv.bodies) != 1 {
+		t.Fatalf("Ожидалось одно доставленное уведомление, получено %d", len(rcv.bodies))
+	}
+	if rcv.signatures[0] != orchestrator.SignWebhook("secret", rcv.bodies[0]) {
+		t.Errorf("Неверная подпись уведомления: %s", rcv.signatures[0])
+	}
+	var expr models.Expression
+	if err := json.Unmarshal(rcv.bodies[0], &expr); err != nil {
+		t.Fatalf("Тело уведомления не разбирается: %v", err)
+	}
+	if expr.ID != id || expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != 42 {
+		t.Errorf("Неверное тело уведомления: %+v", expr)
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		attempts int
+	}{
+		{"ошибка получателя повторяется", http.StatusInternalServerError, 3},
+		{"отказ получателя окончателен", http.StatusBadRequest, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rcv := &webhookReceiver{fail: 100, failStatus: tc.status}
+			receiver := httptest.NewServer(rcv)
+			defer receiver.Close()
+			_, ts := newWebhookServer(t, 3)
+
+			id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "1/0", "callback_url": receiver.URL})
+			task := fetchTask(t, ts.URL)
+			submitResults(t, ts.URL, models.Result{ID: task.ID, Error: "деление на ноль"})
+
+			delivery := waitWebhook(t, ts.URL, id)
+			if delivery.Status != models.WebhookFailed || delivery.Attempts != tc.attempts || delivery.LastError == "" {
+				t.Errorf("Неверное состояние доставки: %+v", delivery)
+			}
+		})
+	}
+}
+
+func TestWebhookRejectsBadCallbackURL(t *testing.T) {
+	_, ts := newWebhookServer(t, 1)
+	resp := postJSON(t, ts.URL+"/api/v1/calculate", map[string]interface{}{"expression": "1+1", "callback_url": "ftp://example"}, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался статус 422, получен %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookRequiresSecret(t *testing.T) {
+	server, ts := newWebhookServer(t, 1)
+	server.WebhookSecret = ""
+	resp := postJSON(t, ts.URL+"/api/v1/calculate", map[string]interface{}{"expression": "1+1", "callback_url": "https://example.com/hook"}, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Без WEBHOOK_SECRET ожидался статус 422, получен %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookRejectsInternalTargets(t *testing.T) {
+	server, ts := newWebhookServer(t, 3)
+	server.WebhookAllowedNets = nil
+	for _, target := range []string{
+		ts.URL + "/internal/task",
+		"http://localhost/hook",
+		"http://LOCALHOST./hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		resp := postJSON(t, ts.URL+"/api/v1/calculate", map[string]interface{}{"expression": "1+1", "callback_url": target}, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: ожидался статус 422, получен %d", target, resp.StatusCode)
+		}
+	}
+
+	// Имя, разрешающееся во внутренний адрес, проверяется при подключении.
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("Имя узла неизвестно")
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 || !(ips[0].IsLoopback() || ips[0].IsPrivate()) {
+		t.Skipf("Имя узла %s не разрешается во внутренний адрес", host)
+	}
+	rcv := &webhookReceiver{}
+	receiver := httptest.NewServer(rcv)
+	defer receiver.Close()
+	_, port, _ := net.SplitHostPort(receiver.Listener.Addr().String())
+	id := submitExpression(t, ts.URL, map[string]interface{}{"expression": "2+2", "callback_url": "http://" + net.JoinHostPort(host, port) + "/hook"})
+	drainTasks(t, ts.URL)
+	delivery := waitWebhook(t, ts.URL, id)
+	if delivery.Status != models.WebhookFailed || delivery.Attempts != 1 {
+		t.Errorf("Отправка во внутреннюю сеть должна окончательно не удаться: %+v", delivery)
+	}
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if rcv.calls != 0 {
+		t.Errorf("Уведомление не должно доходить до внутреннего адреса, запросов %d", rcv.calls)
+	}
+}